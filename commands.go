@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/windowmonitor/pkg/config"
+	"github.com/windowmonitor/pkg/keyring"
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// dataKeyName is the keyring entry that holds the data file key.
+const dataKeyName = "data-key"
+
+// openKeyring returns the keyring selected in the config.
+func openKeyring(cfg *config.Config, dataDir string) (keyring.Keyring, error) {
+	if cfg.Keyring == "file" {
+		return keyring.FileKeyring{Dir: filepath.Join(dataDir, "keys")}, nil
+	}
+	return keyring.NewDefault(filepath.Join(dataDir, "keys"))
+}
+
+// dataKeys returns the source of the data file key, or nil if encryption
+// is off.
+func dataKeys(cfg *config.Config, dataDir string) (storage.KeySource, error) {
+	switch cfg.Encryption {
+	case "passphrase":
+		passphrase := os.Getenv("WINDOWMONITOR_PASSPHRASE")
+		if passphrase == "" {
+			return nil, fmt.Errorf("WINDOWMONITOR_PASSPHRASE is not set")
+		}
+		return storage.Passphrase(passphrase), nil
+	case "keyring":
+		kr, err := openKeyring(cfg, dataDir)
+		if err != nil {
+			return nil, err
+		}
+		return keyring.DataKey{Keyring: kr, Name: dataKeyName}, nil
+	}
+	return nil, nil
+}
+
+// openStorage opens the storage selected in the config, returning the key
+// source for encrypted data as well.
+func openStorage(cfg *config.Config, dataDir string) (storage.Storage, storage.KeySource, error) {
+	keys, err := dataKeys(cfg, dataDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load encryption key: %v", err)
+	}
+	location, err := cfg.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+	day := storage.Day{StartHour: cfg.DayStartHour, Location: location}
+
+	db, err := storage.Open(dataDir, cfg.StorageBackend, day, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, keys, nil
+}
+
+// runCommand runs a maintenance command instead of the monitor. With the
+// file backend the commands refuse to run while the monitor has the data
+// file open.
+func runCommand(args []string, cfg *config.Config, dataDir string) error {
+	switch args[0] {
+	case "forget":
+		return forget(args[1:], cfg, dataDir)
+	case "reencrypt":
+		return reencrypt(args[1:], cfg, dataDir)
+	case "rekey":
+		return rekey(cfg, dataDir)
+	}
+	return fmt.Errorf("unknown command %q; available commands: forget, reencrypt, rekey", args[0])
+}
+
+// forget deletes history selected by flags from the storage and backups.
+func forget(args []string, cfg *config.Config, dataDir string) error {
+	flags := flag.NewFlagSet("forget", flag.ContinueOnError)
+	title := flags.String("title", "", "forget windows with exactly this title")
+	titleRegex := flags.String("title-regex", "", "forget windows whose title matches this regular expression")
+	app := flags.String("app", "", "forget windows of this application")
+	from := flags.String("from", "", "forget time from this date or RFC 3339 time")
+	to := flags.String("to", "", "forget time up to and including this date, or until this RFC 3339 time")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, keys, err := openStorage(cfg, dataDir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	sel := storage.Selector{Title: *title, App: *app}
+	if *titleRegex != "" {
+		if sel.TitlePattern, err = regexp.Compile(*titleRegex); err != nil {
+			return fmt.Errorf("invalid -title-regex: %v", err)
+		}
+	}
+	if sel.From, err = db.Day().ParseTime(*from, false); err != nil {
+		return err
+	}
+	if sel.To, err = db.Day().ParseTime(*to, true); err != nil {
+		return err
+	}
+
+	report, err := storage.Eraser{Storage: db, Dir: dataDir, Keys: keys}.Forget(sel)
+	if err != nil {
+		return err
+	}
+	log.Printf("Forgot %s: %d sessions, %d backups cleaned", sel, report.Sessions, report.Backups)
+	for _, path := range report.Leftovers {
+		log.Printf("%s may still hold the data; delete it if it is no longer needed", path)
+	}
+	return nil
+}
+
+// reencrypt rewrites the data file and its backups with the configured
+// encryption, so data written before encryption was enabled matches the
+// config. With -decrypt, data encrypted under the given former setting is
+// written back as plaintext after encryption was disabled.
+func reencrypt(args []string, cfg *config.Config, dataDir string) error {
+	flags := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	decrypt := flags.String("decrypt", "", "decrypt data encrypted with this former encryption setting, \"keyring\" or \"passphrase\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if cfg.StorageBackend != storage.BackendFile {
+		return fmt.Errorf("reencrypt needs storage_backend \"file\"")
+	}
+	lock, err := lockData(dataDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if *decrypt == "" {
+		keys, err := dataKeys(cfg, dataDir)
+		if err != nil {
+			return err
+		}
+		return rewriteData(dataDir, keys, keys)
+	}
+
+	if cfg.Encryption != "" {
+		return fmt.Errorf("disable encryption before decrypting the data")
+	}
+	if *decrypt != "keyring" && *decrypt != "passphrase" {
+		return fmt.Errorf("invalid -decrypt %q; use \"keyring\" or \"passphrase\"", *decrypt)
+	}
+	old := *cfg
+	old.Encryption = *decrypt
+	from, err := dataKeys(&old, dataDir)
+	if err != nil {
+		return err
+	}
+	return rewriteData(dataDir, from, nil)
+}
+
+// rekey switches the data to a new key: a new random key for the keyring,
+// or the passphrase in WINDOWMONITOR_NEW_PASSPHRASE.
+func rekey(cfg *config.Config, dataDir string) error {
+	lock, err := lockData(dataDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	switch cfg.Encryption {
+	case "passphrase":
+		old, err := dataKeys(cfg, dataDir)
+		if err != nil {
+			return err
+		}
+		passphrase := os.Getenv("WINDOWMONITOR_NEW_PASSPHRASE")
+		if passphrase == "" {
+			return fmt.Errorf("WINDOWMONITOR_NEW_PASSPHRASE is not set")
+		}
+		if err := rewriteData(dataDir, old, storage.Passphrase(passphrase)); err != nil {
+			return err
+		}
+		log.Printf("Data re-encrypted; set WINDOWMONITOR_PASSPHRASE to the new passphrase")
+		return nil
+
+	case "keyring":
+		kr, err := openKeyring(cfg, dataDir)
+		if err != nil {
+			return err
+		}
+		old, err := kr.Get(dataKeyName)
+		if err != nil {
+			return fmt.Errorf("failed to read current key: %v", err)
+		}
+		// A rekey that did not finish left its new key behind; finish the
+		// job with it, since some files may already use it
+		key, err := kr.Get(dataKeyName + ".next")
+		if errors.Is(err, keyring.ErrNotFound) {
+			if key, err = keyring.NewKey(); err != nil {
+				return err
+			}
+			if err := kr.Set(dataKeyName+".next", key); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s.next: %v", dataKeyName, err)
+		}
+		// The current key stays in place until every file is rewritten,
+		// with a copy in case replacing it goes wrong
+		if err := kr.Set(dataKeyName+".prev", old); err != nil {
+			return err
+		}
+		if err := rewriteData(dataDir, storage.StaticKey(old), storage.StaticKey(key)); err != nil {
+			return fmt.Errorf("%v; the key was not changed and the new one is kept as %s.next, run rekey again to finish", err, dataKeyName)
+		}
+		if err := kr.Set(dataKeyName, key); err != nil {
+			return fmt.Errorf("data was re-encrypted but the new key could not be stored; it is kept as %s.next and the old one as %s.prev: %v", dataKeyName, dataKeyName, err)
+		}
+		kr.Delete(dataKeyName + ".next")
+		kr.Delete(dataKeyName + ".prev")
+		log.Printf("Data re-encrypted with a new key")
+		return nil
+	}
+	return fmt.Errorf("rekey needs encryption to be enabled")
+}
+
+// lockData keeps the monitor from opening the data file while a command
+// rewrites it, and fails if it already has.
+func lockData(dataDir string) (*storage.FileLock, error) {
+	return storage.LockFile(filepath.Join(dataDir, "window_stats.json"))
+}
+
+// rewriteData re-encrypts the data file, then the backups.
+func rewriteData(dataDir string, from, to storage.KeySource) error {
+	dataPath := filepath.Join(dataDir, "window_stats.json")
+	if err := storage.Reencrypt(dataPath, from, to); err != nil {
+		return fmt.Errorf("failed to re-encrypt %s: %v", dataPath, err)
+	}
+	n, err := storage.ReencryptBackups(filepath.Join(dataDir, "backups"), from, to)
+	if err != nil {
+		return err
+	}
+	log.Printf("Re-encrypted %s and %d backups", dataPath, n)
+	return nil
+}
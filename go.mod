@@ -4,16 +4,30 @@ go 1.21
 
 require (
 	github.com/getlantern/systray v1.2.2
+	golang.org/x/crypto v0.33.0
 	golang.org/x/sys v0.30.0
+	modernc.org/sqlite v1.29.10
 )
 
 require (
-	github.com/getlantern/context v0.0.0-20190109183933-c447772a6520 
-	github.com/getlantern/errors v0.0.0-20190325191628-abdb3e3e36f7 
-	github.com/getlantern/golog v0.0.0-20190830074920-4ef2e798c2d7 
-	github.com/getlantern/hex v0.0.0-20190417191902-c6586a6fe0b7 
-	github.com/getlantern/hidden v0.0.0-20190325191715-f02dbb02be55 
-	github.com/getlantern/ops v0.0.0-20190325191751-d70cb0d6f85f
-	github.com/go-stack/stack v1.8.0 
-	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c 
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/getlantern/context v0.0.0-20190109183933-c447772a6520 // indirect
+	github.com/getlantern/errors v0.0.0-20190325191628-abdb3e3e36f7 // indirect
+	github.com/getlantern/golog v0.0.0-20190830074920-4ef2e798c2d7 // indirect
+	github.com/getlantern/hex v0.0.0-20190417191902-c6586a6fe0b7 // indirect
+	github.com/getlantern/hidden v0.0.0-20190325191715-f02dbb02be55 // indirect
+	github.com/getlantern/ops v0.0.0-20190325191751-d70cb0d6f85f // indirect
+	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
+	modernc.org/libc v1.49.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	modernc.org/strutil v1.2.0 // indirect
+	modernc.org/token v1.1.0 // indirect
 )
@@ -2,14 +2,22 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
+	// Time zone names must resolve on Windows, which has no zoneinfo files
+	_ "time/tzdata"
 
 	"github.com/windowmonitor/pkg/analytics"
+	"github.com/windowmonitor/pkg/category"
+	"github.com/windowmonitor/pkg/config"
 	"github.com/windowmonitor/pkg/monitor"
 	"github.com/windowmonitor/pkg/notification"
+	"github.com/windowmonitor/pkg/privacy"
 	"github.com/windowmonitor/pkg/storage"
 	"github.com/windowmonitor/pkg/systray"
 )
@@ -25,28 +33,114 @@ func main() {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
-	// Initialize the storage with SQLite database
-	db, err := storage.NewStorage(filepath.Join(dataDir, "window_stats.db"))
+	cfg, err := config.Load(filepath.Join(dataDir, "config.json"))
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:], cfg, dataDir); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	db, keys, err := openStorage(cfg, dataDir)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 	defer db.Close()
 
 	// Initialize components
-	monitor := monitor.NewWindowMonitor(db)
+	source, err := monitor.NewDefaultSource()
+	if err != nil {
+		log.Fatalf("Failed to open window source: %v", err)
+	}
+	if closer, ok := source.(io.Closer); ok {
+		defer closer.Close()
+	}
+	idle, err := monitor.NewDefaultIdleDetector()
+	if err != nil {
+		log.Printf("Idle detection unavailable: %v", err)
+	}
+	windowMonitor := monitor.NewWindowMonitor(db, source, notification.NewDesktopNotifier(db))
+	if idle != nil {
+		windowMonitor.SetIdleDetector(idle, time.Duration(cfg.IdleThreshold))
+	}
+	windowMonitor.SetSessionWatcher(monitor.NewDefaultSessionWatcher())
+	windowMonitor.SetGapPolicy(monitor.GapPolicy(cfg.GapPolicy), time.Duration(cfg.MaxGap))
+
+	// Private titles are filtered before anything is stored or shown, so
+	// refuse to start with rules that cannot be read
+	policy, err := privacy.Load(filepath.Join(dataDir, "privacy.json"))
+	if err != nil {
+		log.Fatalf("Failed to load privacy rules: %v", err)
+	}
+	windowMonitor.SetTitleFilter(policy)
+	// The live status shows the focused title, so it is filtered again as
+	// soon as the rules change
+	go policy.Watch(5*time.Second, windowMonitor.RefreshStatus)
+
+	categories, err := category.Load(filepath.Join(dataDir, "categories.json"))
+	if err != nil {
+		log.Fatalf("Failed to load category rules: %v", err)
+	}
+	windowMonitor.SetCategorizer(categories)
+	// Bring the history in line with rules edited while not running, and
+	// again whenever they change
+	go func() {
+		reapplyCategories(categories, db)
+		categories.Watch(5*time.Second, func() {
+			windowMonitor.RefreshStatus()
+			reapplyCategories(categories, db)
+		})
+	}()
 	visualizer := analytics.NewVisualizer(db)
+	visualizer.SetEraser(storage.Eraser{Storage: db, Dir: dataDir, Keys: keys})
+	visualizer.SetLive(windowMonitor)
 	notifier := notification.NewNotifier(db)
-	trayManager := systray.NewTrayManager(db, visualizer)
+	trayManager := systray.NewTrayManager(db, visualizer, windowMonitor)
+	if len(cfg.Productivity) > 0 {
+		productivity := analytics.NewProductivity(db, analytics.NewRatings(cfg.Productivity))
+		visualizer.SetProductivity(productivity)
+		trayManager.SetProductivity(productivity)
+	}
 
 	// Start the visualization server
 	go func() {
-		if err := visualizer.StartServer(":8080"); err != nil {
+		if err := visualizer.StartServer("127.0.0.1:8080"); err != nil {
 			log.Printf("Failed to start visualization server: %v", err)
 		}
 	}()
 
 	// Start the monitoring process
-	go monitor.Start()
+	go windowMonitor.Start()
+
+	// Roll up and expire old data and take backups in the background
+	retention := storage.Retention{RawDays: cfg.RawRetentionDays, MaxDays: cfg.MaxRetentionDays}
+	backupDir := filepath.Join(dataDir, "backups")
+	go func() {
+		for {
+			report, err := db.ApplyRetention(retention, time.Now())
+			if err != nil {
+				log.Printf("Retention error: %v", err)
+			} else if report.Changed() {
+				log.Printf("Retention: %s", report)
+			}
+
+			if cfg.BackupCount > 0 {
+				latest, err := storage.LatestBackup(backupDir)
+				if err != nil {
+					log.Printf("Backup error: %v", err)
+				} else if time.Since(latest) >= time.Duration(cfg.BackupInterval) {
+					if _, err := storage.RotateBackups(db, backupDir, cfg.BackupCount, time.Now()); err != nil {
+						log.Printf("Backup error: %v", err)
+					}
+				}
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
 
 	// Start the notification checker
 	go func() {
@@ -58,6 +152,14 @@ func main() {
 		}
 	}()
 
+	// Quit through the tray on Ctrl+C so the open session is recorded
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		trayManager.Quit()
+	}()
+
 	// Start system tray
 	fmt.Println("Starting Window Monitor...")
 	fmt.Println("View analytics dashboard at http://localhost:8080")
@@ -65,4 +167,15 @@ func main() {
 
 	// Run the system tray (this blocks)
 	trayManager.Start()
-}
\ No newline at end of file
+}
+
+// reapplyCategories updates the categories of the stored history to the
+// current rules.
+func reapplyCategories(categories *category.Engine, db storage.Storage) {
+	n, err := categories.Reapply(db)
+	if err != nil {
+		log.Printf("Failed to reapply category rules: %v", err)
+	} else if n > 0 {
+		log.Printf("Recategorized %d sessions", n)
+	}
+}
@@ -0,0 +1,329 @@
+package analytics
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// openAPIDocument describes the JSON API under /api/v1.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// apiError is the body of every error response.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	// Code is a stable identifier such as "invalid_parameter".
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiList is the body of every list response. Total counts the items
+// before paging.
+type apiList struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	GroupBy string    `json:"group_by,omitempty"`
+	Offset  int       `json:"offset"`
+	Limit   int       `json:"limit"`
+	Total   int       `json:"total"`
+	Items   any       `json:"items"`
+}
+
+// apiGroup is one group of aggregated usage.
+type apiGroup struct {
+	Key             string    `json:"key"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	App             string    `json:"app,omitempty"`
+	Category        string    `json:"category,omitempty"`
+	Rating          Rating    `json:"rating,omitempty"`
+}
+
+// apiSession is one recorded session.
+type apiSession struct {
+	Title           string    `json:"title"`
+	App             string    `json:"app"`
+	Process         string    `json:"process,omitempty"`
+	PID             uint32    `json:"pid,omitempty"`
+	Class           string    `json:"class,omitempty"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	State           string    `json:"state"`
+	Category        string    `json:"category,omitempty"`
+	Tags            []string  `json:"tags,omitempty"`
+	Interrupted     bool      `json:"interrupted,omitempty"`
+	Rollup          bool      `json:"rollup,omitempty"`
+}
+
+// badRequest is an invalid query parameter.
+type badRequest struct {
+	param string
+	err   error
+}
+
+func (e *badRequest) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.param, e.err)
+}
+
+func (v *Visualizer) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/stats", v.apiHandler(v.handleAPIStats))
+	mux.HandleFunc("/api/v1/apps", v.apiHandler(v.handleAPIApps))
+	mux.HandleFunc("/api/v1/categories", v.apiHandler(v.handleAPICategories))
+	mux.HandleFunc("/api/v1/sessions", v.apiHandler(v.handleAPISessions))
+	mux.HandleFunc("/api/v1/openapi.json", v.apiHandler(func(r *http.Request) (any, error) {
+		return json.RawMessage(openAPIDocument), nil
+	}))
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not_found", fmt.Sprintf("no API endpoint at %s", r.URL.Path))
+	})
+}
+
+// apiHandler serves a read-only endpoint, writing what handle returns as
+// JSON and its errors as error bodies.
+func (v *Visualizer) apiHandler(handle func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed",
+				fmt.Sprintf("method %s is not allowed", r.Method))
+			return
+		}
+		body, err := handle(r)
+		if bad, ok := err.(*badRequest); ok {
+			writeAPIError(w, http.StatusBadRequest, "invalid_parameter", bad.Error())
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(body)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Error: apiErrorDetail{Code: code, Message: message}})
+}
+
+func (v *Visualizer) handleAPIStats(r *http.Request) (any, error) {
+	groupBy, err := storage.ParseGroupBy(r.URL.Query().Get("group_by"))
+	if err != nil {
+		return nil, &badRequest{"group_by", err}
+	}
+	return v.groups(r, groupBy)
+}
+
+func (v *Visualizer) handleAPIApps(r *http.Request) (any, error) {
+	return v.groups(r, storage.GroupByApp)
+}
+
+func (v *Visualizer) handleAPICategories(r *http.Request) (any, error) {
+	return v.groups(r, storage.GroupByCategory)
+}
+
+// groups answers a stats query grouped by groupBy.
+func (v *Visualizer) groups(r *http.Request, groupBy storage.GroupBy) (any, error) {
+	q, offset, limit, err := v.parseAPIQuery(r)
+	if err != nil {
+		return nil, err
+	}
+	q.GroupBy = groupBy
+	stats, err := v.storage.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := v.location()
+	items := make([]apiGroup, 0, limit)
+	for _, stat := range storage.Page(stats, offset, limit) {
+		group := apiGroup{
+			Key:             stat.Title,
+			DurationSeconds: stat.Duration.Seconds(),
+			Start:           stat.Start.In(loc),
+			End:             stat.Date.In(loc),
+		}
+		switch groupBy {
+		case storage.GroupByTitle:
+			group.App = stat.AppName()
+			group.Category = stat.Category
+		case storage.GroupByCategory:
+			if v.productivity != nil {
+				group.Rating = v.productivity.Rating(stat.Title)
+			}
+		}
+		items = append(items, group)
+	}
+	return apiList{
+		From:    q.From.In(loc),
+		To:      q.To.In(loc),
+		GroupBy: string(groupBy),
+		Offset:  offset,
+		Limit:   limit,
+		Total:   len(stats),
+		Items:   items,
+	}, nil
+}
+
+// handleAPISessions lists the sessions that overlap the range, in every
+// state unless one is asked for, oldest first.
+func (v *Visualizer) handleAPISessions(r *http.Request) (any, error) {
+	q, offset, limit, err := v.parseAPIQuery(r)
+	if err != nil {
+		return nil, err
+	}
+	state, all := "", true
+	if values, ok := r.URL.Query()["state"]; ok {
+		state, all = values[0], false
+		switch state {
+		case "active":
+			state = storage.StateActive
+		case storage.StateIdle, storage.StateLocked, storage.StateAsleep, storage.StateGap:
+		default:
+			return nil, &badRequest{"state", fmt.Errorf("unknown state %q", state)}
+		}
+	}
+	sessions, err := v.storage.Sessions(q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []storage.WindowStats
+	for _, stat := range sessions {
+		if (all || stat.State == state) && q.Matches(stat) {
+			matched = append(matched, stat)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Start.Before(matched[j].Start)
+	})
+
+	loc := v.location()
+	items := make([]apiSession, 0, limit)
+	for _, stat := range storage.Page(matched, offset, limit) {
+		s := apiSession{
+			Title:           stat.Title,
+			App:             stat.AppName(),
+			Process:         stat.Process,
+			PID:             stat.PID,
+			Class:           stat.Class,
+			Start:           stat.Start.In(loc),
+			End:             stat.Date.In(loc),
+			DurationSeconds: stat.Duration.Seconds(),
+			State:           stat.State,
+			Category:        stat.Category,
+			Tags:            stat.Tags,
+			Interrupted:     stat.Interrupted,
+			Rollup:          stat.Rollup,
+		}
+		if s.State == storage.StateActive {
+			s.State = "active"
+		}
+		items = append(items, s)
+	}
+	return apiList{
+		From:   q.From.In(loc),
+		To:     q.To.In(loc),
+		Offset: offset,
+		Limit:  limit,
+		Total:  len(matched),
+		Items:  items,
+	}, nil
+}
+
+// parseAPIQuery reads the parameters shared by the list endpoints: the
+// range (today so far by default), filters and paging. Offset and limit
+// are returned separately so that the total can be counted before paging.
+func (v *Visualizer) parseAPIQuery(r *http.Request) (q storage.Query, offset, limit int, err error) {
+	params := r.URL.Query()
+	day := v.storage.Day()
+	now := time.Now()
+
+	q.From = day.Start(now)
+	if s := params.Get("from"); s != "" {
+		if q.From, err = day.ParseTime(s, false); err != nil {
+			return q, 0, 0, &badRequest{"from", err}
+		}
+	}
+	q.To = now
+	if s := params.Get("to"); s != "" {
+		if q.To, err = day.ParseTime(s, true); err != nil {
+			return q, 0, 0, &badRequest{"to", err}
+		}
+	}
+	if !q.To.After(q.From) {
+		return q, 0, 0, &badRequest{"to", fmt.Errorf("must be after from")}
+	}
+
+	if q.App, err = compileParam(params.Get("app")); err != nil {
+		return q, 0, 0, &badRequest{"app", err}
+	}
+	if q.Title, err = compileParam(params.Get("title")); err != nil {
+		return q, 0, 0, &badRequest{"title", err}
+	}
+	q.Tags = params["tag"]
+	switch params.Get("interrupted") {
+	case "", "include":
+	case "exclude":
+		q.Filters = append(q.Filters, storage.SkipInterrupted)
+	default:
+		return q, 0, 0, &badRequest{"interrupted", fmt.Errorf("must be include or exclude")}
+	}
+
+	if offset, err = intParam(params.Get("offset"), 0); err != nil || offset < 0 {
+		return q, 0, 0, &badRequest{"offset", fmt.Errorf("must be a non-negative integer")}
+	}
+	if limit, err = intParam(params.Get("limit"), defaultPageSize); err != nil || limit < 1 || limit > maxPageSize {
+		return q, 0, 0, &badRequest{"limit", fmt.Errorf("must be between 1 and %d", maxPageSize)}
+	}
+	return q, offset, limit, nil
+}
+
+func compileParam(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+func intParam(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// location returns the time zone that days are counted in, which API
+// times are given in.
+func (v *Visualizer) location() *time.Location {
+	if loc := v.storage.Day().Location; loc != nil {
+		return loc
+	}
+	return time.Local
+}
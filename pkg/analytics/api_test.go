@@ -0,0 +1,57 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPILoopbackOnly(t *testing.T) {
+	v, _ := newTestVisualizer(t, "Secret")
+	handler := v.handler()
+
+	for _, path := range []string{"/api/v1/stats", "/api/v1/sessions"} {
+		for _, tt := range []struct {
+			remote string
+			host   string
+			want   int
+		}{
+			{"127.0.0.1:50000", "localhost:8080", http.StatusOK},
+			{"[::1]:50000", "[::1]:8080", http.StatusOK},
+			{"192.168.1.20:50000", "localhost:8080", http.StatusForbidden},
+			{"[2001:db8::1]:50000", "localhost:8080", http.StatusForbidden},
+			{"127.0.0.1:50000", "attacker.example", http.StatusForbidden},
+		} {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.RemoteAddr = tt.remote
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s from %s to %s: status %d, want %d", path, tt.remote, tt.host, w.Code, tt.want)
+				continue
+			}
+			if w.Code != http.StatusOK {
+				if strings.Contains(w.Body.String(), "Secret") {
+					t.Errorf("%s from %s to %s: refused response holds the title", path, tt.remote, tt.host)
+				}
+				continue
+			}
+			// Groups name the title as their key, sessions as their title
+			var list struct {
+				Items []struct {
+					Key   string `json:"key"`
+					Title string `json:"title"`
+				} `json:"items"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+				t.Fatalf("%s from %s: %v", path, tt.remote, err)
+			}
+			if len(list.Items) != 1 || list.Items[0].Key+list.Items[0].Title != "Secret" {
+				t.Errorf("%s from %s: got %+v", path, tt.remote, list.Items)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// Heatmap is active time by day of the week and hour of the day.
+type Heatmap struct {
+	From, To time.Time
+	// Cells holds the time per weekday, Monday first, and hour of the day
+	// on the clock.
+	Cells [7][24]time.Duration
+	// Max is the largest cell.
+	Max time.Duration
+}
+
+// BuildHeatmap adds up the active time matched by q into a heatmap. The
+// range, filters and App and Title patterns of q apply; its grouping and
+// paging are ignored.
+func BuildHeatmap(db storage.Storage, q storage.Query) (*Heatmap, error) {
+	q.GroupBy = storage.GroupByHour
+	q.Offset, q.Limit = 0, 0
+	hours, err := db.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Heatmap{From: q.From, To: q.To}
+	for _, hour := range hours {
+		// Hours start on the hour in the day's time zone
+		weekday := (int(hour.Start.Weekday()) + 6) % 7
+		cell := &h.Cells[weekday][hour.Start.Hour()]
+		*cell += hour.Duration
+		if *cell > h.Max {
+			h.Max = *cell
+		}
+	}
+	return h, nil
+}
+
+// Total returns the time in all cells.
+func (h *Heatmap) Total() time.Duration {
+	var total time.Duration
+	for _, day := range h.Cells {
+		for _, cell := range day {
+			total += cell
+		}
+	}
+	return total
+}
@@ -0,0 +1,112 @@
+package analytics
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// cell names a heatmap cell and its time.
+type cell struct {
+	Weekday  time.Weekday
+	Hour     int
+	Duration time.Duration
+}
+
+func TestBuildHeatmap(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name    string
+		day     storage.Day
+		session storage.WindowStats
+		want    []cell
+	}{
+		{
+			// Sunday 10 March 23:30 to Monday 00:45
+			name:    "across midnight",
+			day:     storage.Day{Location: time.UTC},
+			session: appSession("a.exe", utc(3, 10, 23, 30), 75*time.Minute),
+			want: []cell{
+				{time.Monday, 0, 45 * time.Minute},
+				{time.Sunday, 23, 30 * time.Minute},
+			},
+		},
+		{
+			// Split at 04:00 into two days, but still counted by the
+			// clock
+			name:    "across the start of the day",
+			day:     storage.Day{StartHour: 4, Location: time.UTC},
+			session: appSession("a.exe", utc(3, 11, 3, 30), time.Hour),
+			want: []cell{
+				{time.Monday, 3, 30 * time.Minute},
+				{time.Monday, 4, 30 * time.Minute},
+			},
+		},
+		{
+			name:    "across midnight with days starting at 04:00",
+			day:     storage.Day{StartHour: 4, Location: time.UTC},
+			session: appSession("a.exe", utc(3, 10, 23, 30), 75*time.Minute),
+			want: []cell{
+				{time.Monday, 0, 45 * time.Minute},
+				{time.Sunday, 23, 30 * time.Minute},
+			},
+		},
+		{
+			// The same session is Monday morning in Tokyo
+			name:    "in the day's time zone",
+			day:     storage.Day{Location: tokyo},
+			session: appSession("a.exe", utc(3, 10, 23, 30), 75*time.Minute),
+			want: []cell{
+				{time.Monday, 8, 30 * time.Minute},
+				{time.Monday, 9, 45 * time.Minute},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestStorage(t, tt.day, tt.session)
+			h, err := BuildHeatmap(db, storage.Query{From: utc(3, 9, 0, 0), To: utc(3, 13, 0, 0)})
+			if err != nil {
+				t.Fatalf("BuildHeatmap: %v", err)
+			}
+			var got []cell
+			for weekday, hours := range h.Cells {
+				for hour, d := range hours {
+					if d != 0 {
+						got = append(got, cell{time.Weekday((weekday + 1) % 7), hour, d})
+					}
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("cells = %v, want %v", got, tt.want)
+			}
+			var max time.Duration
+			for _, c := range tt.want {
+				if c.Duration > max {
+					max = c.Duration
+				}
+			}
+			if h.Total() != tt.session.Duration || h.Max != max {
+				t.Errorf("total %v, max %v, want %v, %v", h.Total(), h.Max, tt.session.Duration, max)
+			}
+		})
+	}
+}
+
+func TestBuildHeatmapRange(t *testing.T) {
+	db := newTestStorage(t, storage.Day{Location: time.UTC},
+		appSession("a.exe", utc(3, 10, 23, 30), 75*time.Minute),
+		appSession("b.exe", utc(3, 11, 10, 0), time.Hour),
+	)
+	// Only the part of the first session from midnight is in range
+	h, err := BuildHeatmap(db, storage.Query{From: utc(3, 11, 0, 0), To: utc(3, 12, 0, 0), App: regexp.MustCompile("^a")})
+	if err != nil {
+		t.Fatalf("BuildHeatmap: %v", err)
+	}
+	if h.Total() != 45*time.Minute || h.Cells[0][0] != 45*time.Minute || h.Max != 45*time.Minute {
+		t.Errorf("total %v, Monday 00:00 %v, max %v", h.Total(), h.Cells[0][0], h.Max)
+	}
+}
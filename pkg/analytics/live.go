@@ -0,0 +1,143 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/windowmonitor/pkg/monitor"
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// LiveSource reports what the user is doing as it happens. It is
+// implemented by monitor.WindowMonitor.
+type LiveSource interface {
+	Subscribe() (<-chan monitor.Event, func())
+	Status() monitor.Status
+}
+
+// keepAliveInterval is how often an idle event stream sends a comment so
+// that proxies and browsers keep it open.
+const keepAliveInterval = 30 * time.Second
+
+// liveStatus is the data of a status event.
+type liveStatus struct {
+	// State is "active", "idle", "locked" or "asleep". Title and App are
+	// empty when State is "active" but no window is tracked.
+	State    string    `json:"state"`
+	Title    string    `json:"title,omitempty"`
+	App      string    `json:"app,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Hidden   bool      `json:"hidden,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+// liveSession is the data of a session event.
+type liveSession struct {
+	Title           string    `json:"title"`
+	App             string    `json:"app"`
+	State           string    `json:"state"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// SetLive makes the dashboard follow source and update itself as the user
+// switches windows.
+func (v *Visualizer) SetLive(source LiveSource) {
+	v.live = source
+}
+
+// handleEvents streams the monitor's events as Server-Sent Events: a
+// "status" event with the current status on connect and on every change,
+// and a "session" event whenever a session is saved.
+func (v *Visualizer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if v.live == nil {
+		http.NotFound(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := v.live.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	loc := v.location()
+	if err := writeEvent(w, "status", statusData(v.live.Status(), loc)); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch ev.Type {
+			case monitor.EventStatus:
+				err = writeEvent(w, "status", statusData(ev.Status, loc))
+			case monitor.EventSession:
+				state := ev.Session.State
+				if state == storage.StateActive {
+					state = "active"
+				}
+				err = writeEvent(w, "session", liveSession{
+					Title:           ev.Session.Title,
+					App:             ev.Session.AppName(),
+					State:           state,
+					Start:           ev.Session.Start.In(loc),
+					End:             ev.Session.Date.In(loc),
+					DurationSeconds: ev.Session.Duration.Seconds(),
+				})
+			}
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func statusData(status monitor.Status, loc *time.Location) liveStatus {
+	data := liveStatus{
+		State:  status.State,
+		Hidden: status.Hidden,
+		Since:  status.Since.In(loc),
+	}
+	if data.State == storage.StateActive {
+		data.State = "active"
+	}
+	if status.Window.Title != "" {
+		data.Title = status.Window.Title
+		data.App = status.Window.AppName()
+		data.Category = status.Window.Category
+	}
+	return data
+}
+
+// writeEvent writes one Server-Sent Event with data encoded as JSON,
+// which never contains a newline.
+func writeEvent(w http.ResponseWriter, name string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, body)
+	return err
+}
@@ -0,0 +1,170 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// Rating says how time in a category counts towards productivity.
+type Rating string
+
+const (
+	Productive  Rating = "productive"
+	Neutral     Rating = "neutral"
+	Distracting Rating = "distracting"
+)
+
+// Ratings maps category names to their rating. Categories that are not
+// listed, including "Uncategorized", are neutral.
+type Ratings map[string]Rating
+
+// NewRatings converts ratings as read from the config file.
+func NewRatings(ratings map[string]string) Ratings {
+	r := make(Ratings, len(ratings))
+	for category, rating := range ratings {
+		r[category] = Rating(rating)
+	}
+	return r
+}
+
+// Score sums up the active time of one day by rating.
+type Score struct {
+	// Day is the start of the day.
+	Day         time.Time
+	Productive  time.Duration
+	Neutral     time.Duration
+	Distracting time.Duration
+}
+
+// Total returns all active time of the day.
+func (s Score) Total() time.Duration {
+	return s.Productive + s.Neutral + s.Distracting
+}
+
+// Value returns the score from 0 to 100: productive time counts fully,
+// neutral time half and distracting time not at all. It is 0 for a day
+// without activity.
+func (s Score) Value() float64 {
+	total := s.Total()
+	if total <= 0 {
+		return 0
+	}
+	return 100 * (float64(s.Productive) + float64(s.Neutral)/2) / float64(total)
+}
+
+// Trend holds the scores of consecutive days, oldest first.
+type Trend []Score
+
+// Last returns the score of the most recent day.
+func (t Trend) Last() Score {
+	if len(t) == 0 {
+		return Score{}
+	}
+	return t[len(t)-1]
+}
+
+// Change returns the last day's score minus the average score of the
+// earlier days with activity. ok is false if there are none to compare
+// with or the last day had no activity.
+func (t Trend) Change() (change float64, ok bool) {
+	if len(t) < 2 || t.Last().Total() <= 0 {
+		return 0, false
+	}
+	var sum float64
+	var n int
+	for _, s := range t[:len(t)-1] {
+		if s.Total() > 0 {
+			sum += s.Value()
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return t.Last().Value() - sum/float64(n), true
+}
+
+// Describe summarizes the last day's score and how it compares to the
+// earlier days, such as "72 (up 8 on the previous 6 days)".
+func (t Trend) Describe() string {
+	text := fmt.Sprintf("%.0f", t.Last().Value())
+	change, ok := t.Change()
+	if !ok {
+		return text
+	}
+	days := len(t) - 1
+	switch {
+	case change >= 0.5:
+		return fmt.Sprintf("%s (up %.0f on the previous %d days)", text, change, days)
+	case change <= -0.5:
+		return fmt.Sprintf("%s (down %.0f on the previous %d days)", text, -change, days)
+	}
+	return fmt.Sprintf("%s (level with the previous %d days)", text, days)
+}
+
+// Productivity scores days from their usage by category.
+type Productivity struct {
+	db      storage.Storage
+	ratings Ratings
+}
+
+// NewProductivity creates a scorer that rates the categories in db with
+// ratings.
+func NewProductivity(db storage.Storage, ratings Ratings) *Productivity {
+	return &Productivity{db: db, ratings: ratings}
+}
+
+// Rating returns the rating of a category.
+func (p *Productivity) Rating(category string) Rating {
+	if rating, ok := p.ratings[category]; ok {
+		return rating
+	}
+	return Neutral
+}
+
+// Score returns the score of the day containing t.
+func (p *Productivity) Score(t time.Time, filters ...storage.StatsFilter) (Score, error) {
+	day := p.db.Day()
+	score := Score{Day: day.Start(t)}
+	categories, err := p.db.Query(storage.Query{
+		From:    score.Day,
+		To:      day.Next(t),
+		GroupBy: storage.GroupByCategory,
+		Filters: filters,
+	})
+	if err != nil {
+		return score, err
+	}
+	for _, category := range categories {
+		switch p.Rating(category.Title) {
+		case Productive:
+			score.Productive += category.Duration
+		case Distracting:
+			score.Distracting += category.Duration
+		default:
+			score.Neutral += category.Duration
+		}
+	}
+	return score, nil
+}
+
+// Trend returns the scores of the given number of days up to and
+// including the day containing now.
+func (p *Productivity) Trend(now time.Time, days int, filters ...storage.StatsFilter) (Trend, error) {
+	day := p.db.Day()
+	trend := make(Trend, days)
+	t := now
+	for i := days - 1; i >= 0; i-- {
+		score, err := p.Score(t, filters...)
+		if err != nil {
+			return nil, err
+		}
+		trend[i] = score
+		// Step back from the start of the day, which is safe across
+		// daylight saving changes
+		t = day.Start(t).Add(-time.Nanosecond)
+	}
+	return trend, nil
+}
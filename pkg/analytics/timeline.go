@@ -0,0 +1,461 @@
+package analytics
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// TimelineData is what the timeline page is rendered from. The sessions
+// themselves are fetched by the page from the sessions API.
+type TimelineData struct {
+	// Date is the day shown, as used in the date picker.
+	Date string
+	Day  string
+	// From and To bound the day in RFC 3339.
+	From, To string
+	// Previous and Next are the dates of the neighbouring days.
+	Previous, Next string
+	// TimeZone names the zone days are counted in, or is empty for the
+	// system zone.
+	TimeZone string
+}
+
+const timelineTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Timeline - Window Usage Analytics</title>
+    <style>
+        :root {
+            --bg-primary: #1e1e1e;
+            --bg-secondary: #252526;
+            --text-primary: #ffffff;
+            --text-secondary: #cccccc;
+            --accent-color: #0078d4;
+            --border-color: #404040;
+            --hover-color: #2a2d2e;
+        }
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+        body {
+            font-family: 'Segoe UI', -apple-system, BlinkMacSystemFont, sans-serif;
+            background-color: var(--bg-primary);
+            color: var(--text-primary);
+            line-height: 1.5;
+        }
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+            padding: 20px;
+        }
+        .header {
+            padding: 20px 0;
+            border-bottom: 1px solid var(--border-color);
+            margin-bottom: 24px;
+            display: flex;
+            justify-content: space-between;
+            align-items: baseline;
+        }
+        .header h1 {
+            font-size: 24px;
+            font-weight: 500;
+        }
+        .header-day {
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        .header a {
+            color: var(--accent-color);
+            font-size: 14px;
+            text-decoration: none;
+        }
+        .controls {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 16px;
+            align-items: center;
+            margin-bottom: 20px;
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        .controls a {
+            color: var(--accent-color);
+            text-decoration: none;
+        }
+        .controls input, .controls select, .controls button {
+            background-color: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            color: var(--text-primary);
+            padding: 4px 8px;
+        }
+        .controls button {
+            cursor: pointer;
+        }
+        .chart {
+            background-color: var(--bg-secondary);
+            border-radius: 8px;
+            padding: 24px;
+            box-shadow: 0 2px 4px rgba(0, 0, 0, 0.1);
+        }
+        .axis {
+            position: relative;
+            height: 20px;
+            font-size: 12px;
+            color: var(--text-secondary);
+        }
+        .tick {
+            position: absolute;
+            transform: translateX(-50%);
+            cursor: pointer;
+        }
+        .tick:hover {
+            color: var(--text-primary);
+        }
+        .track {
+            position: relative;
+            height: 64px;
+            background-color: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            overflow: hidden;
+        }
+        .gridline {
+            position: absolute;
+            top: 0;
+            bottom: 0;
+            border-left: 1px solid var(--border-color);
+        }
+        .block {
+            position: absolute;
+            top: 8px;
+            bottom: 8px;
+            min-width: 1px;
+        }
+        .block:hover {
+            outline: 1px solid var(--text-primary);
+            z-index: 1;
+        }
+        .block.idle {
+            background: repeating-linear-gradient(45deg, #555 0 4px, transparent 4px 8px);
+        }
+        .block.locked {
+            background: repeating-linear-gradient(-45deg, #8a6d3b 0 4px, transparent 4px 8px);
+        }
+        .block.asleep {
+            background: repeating-linear-gradient(90deg, #3b5b8a 0 2px, transparent 2px 6px);
+        }
+        .block.gap {
+            background: repeating-linear-gradient(0deg, #8a3b3b 0 2px, transparent 2px 6px);
+        }
+        .tooltip {
+            position: fixed;
+            display: none;
+            pointer-events: none;
+            background-color: var(--bg-secondary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            padding: 8px 12px;
+            font-size: 13px;
+            max-width: 400px;
+            z-index: 10;
+        }
+        .tooltip .muted {
+            color: var(--text-secondary);
+        }
+        .legend {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 8px 20px;
+            margin-top: 20px;
+            font-size: 14px;
+            color: var(--text-secondary);
+        }
+        .swatch {
+            display: inline-block;
+            width: 12px;
+            height: 12px;
+            border-radius: 2px;
+            margin-right: 6px;
+            vertical-align: middle;
+        }
+        .message {
+            margin-top: 20px;
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <div>
+                <h1>Timeline</h1>
+                <div class="header-day">{{.Day}}</div>
+            </div>
+            <a href="/">Back to dashboard</a>
+        </div>
+        <div class="controls">
+            <a href="/timeline?date={{.Previous}}">&larr; Previous day</a>
+            <form method="get" action="/timeline">
+                <input type="date" name="date" value="{{.Date}}" onchange="this.form.submit()">
+            </form>
+            <a href="/timeline?date={{.Next}}">Next day &rarr;</a>
+            <label>Color by
+                <select id="color-by">
+                    <option value="app">Application</option>
+                    <option value="category">Category</option>
+                </select>
+            </label>
+            <label>Zoom
+                <select id="zoom">
+                    <option value="">Whole day</option>
+                </select>
+            </label>
+            <button id="zoom-out" type="button">Whole day</button>
+        </div>
+        <div class="chart">
+            <div class="axis" id="axis"></div>
+            <div class="track" id="track"></div>
+            <div class="legend" id="legend"></div>
+            <div class="message" id="message">Loading...</div>
+        </div>
+    </div>
+    <div class="tooltip" id="tooltip"></div>
+    <script>
+        const dayFrom = new Date({{.From}});
+        const dayTo = new Date({{.To}});
+        const stateNames = {idle: 'Idle', locked: 'Locked', asleep: 'Asleep', gap: 'Gap'};
+        const timeZone = {{.TimeZone}} || undefined;
+        let sessions = [];
+        let view = {from: dayFrom, to: dayTo};
+
+        const axis = document.getElementById('axis');
+        const track = document.getElementById('track');
+        const legend = document.getElementById('legend');
+        const message = document.getElementById('message');
+        const tooltip = document.getElementById('tooltip');
+        const colorBy = document.getElementById('color-by');
+        const zoom = document.getElementById('zoom');
+
+        // Each hour of the day can be zoomed into
+        for (let t = new Date(dayFrom); t < dayTo; t = new Date(t.getTime() + 3600000)) {
+            const option = document.createElement('option');
+            option.value = t.toISOString();
+            option.textContent = formatTime(t) + ' - ' + formatTime(new Date(t.getTime() + 3600000));
+            zoom.appendChild(option);
+        }
+
+        function formatTime(t) {
+            return t.toLocaleTimeString([], {hour: '2-digit', minute: '2-digit', timeZone: timeZone});
+        }
+
+        function formatDuration(seconds) {
+            const h = Math.floor(seconds / 3600);
+            const m = Math.floor(seconds / 60) % 60;
+            const s = Math.floor(seconds) % 60;
+            if (h > 0) return h + 'h ' + m + 'm';
+            if (m > 0) return m + 'm ' + s + 's';
+            return s + 's';
+        }
+
+        // Colors are derived from the name so they stay the same across
+        // days and reloads
+        function color(key) {
+            let hash = 0;
+            for (let i = 0; i < key.length; i++) {
+                hash = (hash * 31 + key.charCodeAt(i)) | 0;
+            }
+            return 'hsl(' + (Math.abs(hash) % 360) + ', 55%, 50%)';
+        }
+
+        function keyOf(s) {
+            return colorBy.value === 'category' ? (s.category || 'Uncategorized') : s.app;
+        }
+
+        async function load() {
+            const limit = 1000;
+            for (let offset = 0; ; offset += limit) {
+                const params = new URLSearchParams({
+                    from: dayFrom.toISOString(),
+                    to: dayTo.toISOString(),
+                    offset: offset,
+                    limit: limit,
+                });
+                const response = await fetch('/api/v1/sessions?' + params);
+                const body = await response.json();
+                if (!response.ok) {
+                    throw new Error(body.error.message);
+                }
+                sessions = sessions.concat(body.items);
+                if (offset + limit >= body.total) {
+                    break;
+                }
+            }
+            // Daily totals kept by the retention policy have no times of day
+            sessions = sessions.filter(s => !s.rollup);
+            sessions.forEach(s => {
+                s.startTime = new Date(s.start);
+                s.endTime = new Date(s.end);
+            });
+        }
+
+        function render() {
+            const span = view.to - view.from;
+            const position = t => ((t - view.from) / span) * 100;
+
+            axis.innerHTML = '';
+            track.innerHTML = '';
+            const step = span > 3 * 3600000 ? 3600000 : 600000;
+            const every = span > 3 * 3600000 ? 2 : 1;
+            let n = 0;
+            for (let t = view.from.getTime(); t <= view.to.getTime(); t += step, n++) {
+                const line = document.createElement('div');
+                line.className = 'gridline';
+                line.style.left = position(t) + '%';
+                track.appendChild(line);
+                if (n % every !== 0 || t === view.to.getTime()) continue;
+                const tick = document.createElement('span');
+                tick.className = 'tick';
+                tick.style.left = position(t) + '%';
+                tick.textContent = formatTime(new Date(t));
+                if (step === 3600000) {
+                    tick.title = 'Zoom to this hour';
+                    tick.onclick = () => zoomTo(new Date(t));
+                }
+                axis.appendChild(tick);
+            }
+
+            const totals = {};
+            let shown = 0;
+            sessions.forEach(s => {
+                if (s.endTime <= view.from || s.startTime >= view.to) return;
+                const start = Math.max(s.startTime, view.from);
+                const end = Math.min(s.endTime, view.to);
+                const block = document.createElement('div');
+                block.className = 'block';
+                block.style.left = position(start) + '%';
+                block.style.width = (position(end) - position(start)) + '%';
+                if (s.state === 'active') {
+                    const key = keyOf(s);
+                    block.style.backgroundColor = color(key);
+                    totals[key] = (totals[key] || 0) + s.duration_seconds * (end - start) / (s.endTime - s.startTime);
+                } else {
+                    block.classList.add(s.state);
+                }
+                block.onmousemove = e => showTooltip(e, s);
+                block.onmouseleave = () => tooltip.style.display = 'none';
+                track.appendChild(block);
+                shown++;
+            });
+
+            legend.innerHTML = '';
+            Object.keys(totals).sort((a, b) => totals[b] - totals[a]).forEach(key => {
+                legend.appendChild(legendItem(color(key), key + ' (' + formatDuration(totals[key]) + ')'));
+            });
+            Object.keys(stateNames).forEach(state => {
+                const item = legendItem('', stateNames[state]);
+                item.firstChild.classList.add('block', state);
+                item.firstChild.style.position = 'static';
+                legend.appendChild(item);
+            });
+            message.textContent = shown === 0 ? 'Nothing was recorded in this period.' : '';
+        }
+
+        function legendItem(background, text) {
+            const item = document.createElement('span');
+            const swatch = document.createElement('span');
+            swatch.className = 'swatch';
+            swatch.style.backgroundColor = background;
+            item.appendChild(swatch);
+            item.appendChild(document.createTextNode(text));
+            return item;
+        }
+
+        function showTooltip(e, s) {
+            tooltip.innerHTML = '';
+            const title = document.createElement('div');
+            title.textContent = s.state === 'active' ? s.title : stateNames[s.state] || s.state;
+            tooltip.appendChild(title);
+            const details = [formatTime(s.startTime) + ' - ' + formatTime(s.endTime) + ', ' + formatDuration(s.duration_seconds)];
+            if (s.state === 'active') {
+                details.push(s.app + (s.category ? ' - ' + s.category : ''));
+                if (s.tags && s.tags.length) details.push('Tags: ' + s.tags.join(', '));
+                if (s.interrupted) details.push('Credited across a gap in sampling');
+            }
+            details.forEach(text => {
+                const line = document.createElement('div');
+                line.className = 'muted';
+                line.textContent = text;
+                tooltip.appendChild(line);
+            });
+            tooltip.style.display = 'block';
+            tooltip.style.left = Math.min(e.clientX + 12, window.innerWidth - tooltip.offsetWidth - 8) + 'px';
+            tooltip.style.top = (e.clientY + 12) + 'px';
+        }
+
+        function zoomTo(start) {
+            if (!start) {
+                view = {from: dayFrom, to: dayTo};
+                zoom.value = '';
+            } else {
+                view = {from: start, to: new Date(Math.min(start.getTime() + 3600000, dayTo.getTime()))};
+                zoom.value = start.toISOString();
+            }
+            render();
+        }
+
+        colorBy.onchange = render;
+        zoom.onchange = () => zoomTo(zoom.value ? new Date(zoom.value) : null);
+        document.getElementById('zoom-out').onclick = () => zoomTo(null);
+
+        load().then(render).catch(err => {
+            message.textContent = 'Failed to load sessions: ' + err.message;
+        });
+    </script>
+</body>
+</html>
+`
+
+// handleTimeline serves the timeline of the day given by the date
+// parameter, today by default.
+func (v *Visualizer) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	day := v.storage.Day()
+	start := day.Start(time.Now())
+	if date := r.URL.Query().Get("date"); date != "" {
+		t, err := day.ParseTime(date, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start = day.Start(t)
+	}
+	next := day.Next(start)
+
+	data := TimelineData{
+		Date:     start.Format("2006-01-02"),
+		Day:      describeDay(day, start),
+		From:     start.Format(time.RFC3339),
+		To:       next.Format(time.RFC3339),
+		Previous: day.Start(start.Add(-time.Nanosecond)).Format("2006-01-02"),
+		Next:     next.Format("2006-01-02"),
+	}
+	if day.Location != nil && day.Location != time.Local {
+		data.TimeZone = day.Location.String()
+	}
+
+	tmpl, err := template.New("timeline").Parse(timelineTemplate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,156 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// Period is the length of the intervals a trend is measured over.
+type Period string
+
+const (
+	Week  Period = "week"
+	Month Period = "month"
+)
+
+// ParsePeriod checks a period name, defaulting to Week.
+func ParsePeriod(name string) (Period, error) {
+	switch p := Period(name); p {
+	case "":
+		return Week, nil
+	case Week, Month:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown period %q", name)
+}
+
+// bounds returns the functions that find the start of the period
+// containing a time and the start of the next one.
+func (p Period) bounds(day storage.Day) (start, next func(time.Time) time.Time) {
+	if p == Month {
+		return day.MonthStart, day.NextMonth
+	}
+	return day.WeekStart, day.NextWeek
+}
+
+// Series is the active time of one application or category in each period
+// of a trend report.
+type Series struct {
+	Key       string
+	Durations []time.Duration
+	// Change is the change of the current period so far against the same
+	// part of the previous period, in percent. HasChange is false if there
+	// was no time in the previous period to compare with.
+	Change    float64
+	HasChange bool
+}
+
+// Total returns the time over all periods.
+func (s Series) Total() time.Duration {
+	var total time.Duration
+	for _, d := range s.Durations {
+		total += d
+	}
+	return total
+}
+
+// TrendReport holds the series of a trend, longest total first.
+type TrendReport struct {
+	Period  Period
+	GroupBy storage.GroupBy
+	// Starts holds the start of each period, oldest first. The last one
+	// is the current period and runs until now.
+	Starts []time.Time
+	Series []Series
+}
+
+// BuildTrends measures the active time matched by q, grouped by q.GroupBy
+// (normally applications or categories), over the given number of periods
+// up to and including the one containing now. The filters and App and
+// Title patterns of q apply; its range and paging are ignored.
+func BuildTrends(db storage.Storage, q storage.Query, period Period, periods int, now time.Time) (*TrendReport, error) {
+	if periods < 1 {
+		return nil, fmt.Errorf("need at least one period")
+	}
+	periodStart, nextPeriod := period.bounds(db.Day())
+	q.Offset, q.Limit = 0, 0
+
+	report := &TrendReport{
+		Period:  period,
+		GroupBy: q.GroupBy,
+		Starts:  make([]time.Time, periods),
+	}
+	start := periodStart(now)
+	for i := periods - 1; i >= 0; i-- {
+		report.Starts[i] = start
+		start = periodStart(start.Add(-time.Nanosecond))
+	}
+
+	totals := func(from, to time.Time) (map[string]time.Duration, error) {
+		q.From, q.To = from, to
+		stats, err := db.Query(q)
+		if err != nil {
+			return nil, err
+		}
+		totals := make(map[string]time.Duration, len(stats))
+		for _, stat := range stats {
+			totals[stat.Title] = stat.Duration
+		}
+		return totals, nil
+	}
+
+	series := make(map[string]*Series)
+	for i, from := range report.Starts {
+		to := nextPeriod(from)
+		if i == periods-1 {
+			to = now
+		}
+		durations, err := totals(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for key, d := range durations {
+			s, ok := series[key]
+			if !ok {
+				s = &Series{Key: key, Durations: make([]time.Duration, periods)}
+				series[key] = s
+			}
+			s.Durations[i] = d
+		}
+	}
+
+	// Compare the current period with the same stretch of the previous
+	// one, so that a week that has just begun is not compared with a full
+	// week
+	current := report.Starts[periods-1]
+	previous := periodStart(current.Add(-time.Nanosecond))
+	to := previous.Add(now.Sub(current))
+	if to.After(current) {
+		to = current
+	}
+	earlier, err := totals(previous, to)
+	if err != nil {
+		return nil, err
+	}
+	for key, s := range series {
+		if before := earlier[key]; before > 0 {
+			s.Change = 100 * float64(s.Durations[periods-1]-before) / float64(before)
+			s.HasChange = true
+		}
+	}
+
+	for _, s := range series {
+		report.Series = append(report.Series, *s)
+	}
+	sort.Slice(report.Series, func(i, j int) bool {
+		ti, tj := report.Series[i].Total(), report.Series[j].Total()
+		if ti != tj {
+			return ti > tj
+		}
+		return report.Series[i].Key < report.Series[j].Key
+	})
+	return report, nil
+}
@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// newTestStorage returns a file storage with days defined by day, holding
+// sessions.
+func newTestStorage(t *testing.T, day storage.Day, sessions ...storage.WindowStats) *storage.FileStorage {
+	t.Helper()
+	db, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "window_stats.json"))
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetDay(day)
+	for _, stat := range sessions {
+		if err := db.SaveWindowStats(stat); err != nil {
+			t.Fatalf("SaveWindowStats: %v", err)
+		}
+	}
+	return db
+}
+
+// appSession is a session of app from start for d.
+func appSession(app string, start time.Time, d time.Duration) storage.WindowStats {
+	return storage.WindowStats{Title: app + " window", Process: app, Start: start, Duration: d, Date: start.Add(d)}
+}
+
+func utc(month time.Month, day, hour, min int) time.Time {
+	return time.Date(2024, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestBuildTrends(t *testing.T) {
+	// Weeks start on Monday at 04:00; now is Wednesday 13 March
+	day := storage.Day{StartHour: 4, Location: time.UTC}
+	now := utc(3, 13, 12, 0)
+	db := newTestStorage(t, day,
+		appSession("a.exe", utc(2, 26, 10, 0), time.Hour),
+		appSession("a.exe", utc(3, 5, 9, 0), time.Hour),
+		appSession("b.exe", utc(3, 5, 10, 0), 2*time.Hour),
+		// After the stretch of last week compared with this one
+		appSession("a.exe", utc(3, 8, 10, 0), time.Hour),
+		// Still Sunday until 04:00, so split between the weeks
+		appSession("a.exe", utc(3, 11, 3, 30), time.Hour),
+		appSession("a.exe", utc(3, 12, 10, 0), time.Hour),
+		// After now
+		appSession("c.exe", utc(3, 13, 13, 0), 30*time.Minute),
+	)
+
+	report, err := BuildTrends(db, storage.Query{GroupBy: storage.GroupByApp}, Week, 3, now)
+	if err != nil {
+		t.Fatalf("BuildTrends: %v", err)
+	}
+	wantStarts := []time.Time{utc(2, 26, 4, 0), utc(3, 4, 4, 0), utc(3, 11, 4, 0)}
+	if fmt.Sprint(report.Starts) != fmt.Sprint(wantStarts) {
+		t.Errorf("starts = %v, want %v", report.Starts, wantStarts)
+	}
+	want := []Series{
+		{Key: "a.exe", Durations: []time.Duration{time.Hour, 150 * time.Minute, 90 * time.Minute}, Change: 50, HasChange: true},
+		// No time in the first and the current week
+		{Key: "b.exe", Durations: []time.Duration{0, 2 * time.Hour, 0}, Change: -100, HasChange: true},
+	}
+	if fmt.Sprint(report.Series) != fmt.Sprint(want) {
+		t.Errorf("series = %+v, want %+v", report.Series, want)
+	}
+}
+
+func TestBuildTrendsMonths(t *testing.T) {
+	day := storage.Day{StartHour: 4, Location: time.UTC}
+	now := utc(3, 13, 12, 0)
+	db := newTestStorage(t, day,
+		// Split between February and March at 04:00 on 1 March
+		appSession("a.exe", utc(3, 1, 3, 0), 2*time.Hour),
+	)
+
+	report, err := BuildTrends(db, storage.Query{GroupBy: storage.GroupByApp}, Month, 4, now)
+	if err != nil {
+		t.Fatalf("BuildTrends: %v", err)
+	}
+	wantStarts := []time.Time{
+		time.Date(2023, 12, 1, 4, 0, 0, 0, time.UTC),
+		utc(1, 1, 4, 0), utc(2, 1, 4, 0), utc(3, 1, 4, 0),
+	}
+	if fmt.Sprint(report.Starts) != fmt.Sprint(wantStarts) {
+		t.Errorf("starts = %v, want %v", report.Starts, wantStarts)
+	}
+	// February until the 13th at noon holds no time to compare with
+	want := []Series{
+		{Key: "a.exe", Durations: []time.Duration{0, 0, time.Hour, time.Hour}},
+	}
+	if fmt.Sprint(report.Series) != fmt.Sprint(want) {
+		t.Errorf("series = %+v, want %+v", report.Series, want)
+	}
+
+	// Nothing recorded at all gives no series
+	empty, err := BuildTrends(newTestStorage(t, day), storage.Query{GroupBy: storage.GroupByApp}, Month, 2, now)
+	if err != nil || len(empty.Series) != 0 || len(empty.Starts) != 2 {
+		t.Errorf("empty storage: %+v, %v", empty, err)
+	}
+	if _, err := BuildTrends(db, storage.Query{GroupBy: storage.GroupByApp}, Week, 0, now); err == nil {
+		t.Error("BuildTrends accepted zero periods")
+	}
+}
@@ -0,0 +1,446 @@
+package analytics
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// TrendsData is what the trends page is rendered from.
+type TrendsData struct {
+	// The form fields, as entered
+	From, To, App string
+	Period        string
+	By            string
+	Periods       int
+
+	Range   string
+	Hours   []int
+	Heatmap []HeatmapRow
+
+	// Span describes the periods of the trends
+	Span   string
+	Series []SeriesRow
+}
+
+// HeatmapRow is one weekday of the heatmap.
+type HeatmapRow struct {
+	Day   string
+	Cells []HeatmapCell
+}
+
+// HeatmapCell is one hour of the heatmap.
+type HeatmapCell struct {
+	Label string
+	// Level is the cell's share of the largest cell, from 0 to 1
+	Level float64
+}
+
+// SeriesRow is one application or category of the trends.
+type SeriesRow struct {
+	Key string
+	// Points draws the series as an SVG polyline
+	Points  string
+	Current float64
+	Change  string
+	Up      bool
+}
+
+const (
+	// The size of the sparklines, as set in the template
+	sparklineWidth  = 240
+	sparklineHeight = 40
+	// trendSeries is how many series the page shows
+	trendSeries = 15
+)
+
+const trendsTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Trends - Window Usage Analytics</title>
+    <style>
+        :root {
+            --bg-primary: #1e1e1e;
+            --bg-secondary: #252526;
+            --text-primary: #ffffff;
+            --text-secondary: #cccccc;
+            --accent-color: #0078d4;
+            --border-color: #404040;
+            --hover-color: #2a2d2e;
+        }
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+        body {
+            font-family: 'Segoe UI', -apple-system, BlinkMacSystemFont, sans-serif;
+            background-color: var(--bg-primary);
+            color: var(--text-primary);
+            line-height: 1.5;
+        }
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+            padding: 20px;
+        }
+        .header {
+            padding: 20px 0;
+            border-bottom: 1px solid var(--border-color);
+            margin-bottom: 24px;
+            display: flex;
+            justify-content: space-between;
+            align-items: baseline;
+        }
+        .header h1 {
+            font-size: 24px;
+            font-weight: 500;
+        }
+        .header a {
+            color: var(--accent-color);
+            font-size: 14px;
+            text-decoration: none;
+        }
+        .controls {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 16px;
+            align-items: end;
+            margin-bottom: 24px;
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        .controls label {
+            display: flex;
+            flex-direction: column;
+            gap: 4px;
+        }
+        .controls input, .controls select, .controls button {
+            background-color: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            color: var(--text-primary);
+            padding: 4px 8px;
+        }
+        .controls button {
+            background-color: var(--accent-color);
+            cursor: pointer;
+        }
+        .chart {
+            background-color: var(--bg-secondary);
+            border-radius: 8px;
+            padding: 24px;
+            box-shadow: 0 2px 4px rgba(0, 0, 0, 0.1);
+            overflow-x: auto;
+        }
+        .chart + .chart {
+            margin-top: 24px;
+        }
+        .chart-header {
+            display: flex;
+            justify-content: space-between;
+            align-items: baseline;
+            margin-bottom: 20px;
+        }
+        .chart-title {
+            font-size: 18px;
+            font-weight: 500;
+        }
+        .chart-note {
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        table {
+            border-collapse: collapse;
+            font-size: 12px;
+            color: var(--text-secondary);
+        }
+        .heatmap td {
+            width: 36px;
+            height: 24px;
+            border: 1px solid var(--bg-secondary);
+            background-color: var(--bg-primary);
+        }
+        .heatmap th {
+            font-weight: normal;
+            padding: 0 8px;
+            text-align: right;
+        }
+        .trends {
+            width: 100%;
+            font-size: 14px;
+        }
+        .trends th, .trends td {
+            padding: 8px;
+            text-align: left;
+            border-bottom: 1px solid var(--border-color);
+        }
+        .trends th {
+            font-weight: normal;
+        }
+        .trends td.key {
+            color: var(--text-primary);
+        }
+        .up {
+            color: #89d185;
+        }
+        .down {
+            color: #f14c4c;
+        }
+        polyline {
+            fill: none;
+            stroke: var(--accent-color);
+            stroke-width: 2;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Trends</h1>
+            <a href="/">Back to dashboard</a>
+        </div>
+        <form class="controls" method="get" action="/trends">
+            <label>From<input type="date" name="from" value="{{.From}}"></label>
+            <label>To<input type="date" name="to" value="{{.To}}"></label>
+            <label>Application<input type="text" name="app" value="{{.App}}" placeholder="regular expression"></label>
+            <label>Trend by
+                <select name="by">
+                    <option value="app"{{if eq .By "app"}} selected{{end}}>Application</option>
+                    <option value="category"{{if eq .By "category"}} selected{{end}}>Category</option>
+                </select>
+            </label>
+            <label>Over
+                <select name="period">
+                    <option value="week"{{if eq .Period "week"}} selected{{end}}>Weeks</option>
+                    <option value="month"{{if eq .Period "month"}} selected{{end}}>Months</option>
+                </select>
+            </label>
+            <label>Periods<input type="number" name="periods" min="2" max="52" value="{{.Periods}}"></label>
+            <button type="submit">Update</button>
+        </form>
+        <div class="chart">
+            <div class="chart-header">
+                <h2 class="chart-title">Activity by Hour of the Week</h2>
+                <span class="chart-note">{{.Range}}</span>
+            </div>
+            <table class="heatmap">
+                <tr>
+                    <th></th>
+                    {{range .Hours}}<th>{{.}}</th>{{end}}
+                </tr>
+                {{range .Heatmap}}
+                <tr>
+                    <th>{{.Day}}</th>
+                    {{range .Cells}}<td title="{{.Label}}" style="background-color: rgba(0, 120, 212, {{.Level}});"></td>{{end}}
+                </tr>
+                {{end}}
+            </table>
+        </div>
+        <div class="chart">
+            <div class="chart-header">
+                <h2 class="chart-title">Trends by {{if eq .By "category"}}Category{{else}}Application{{end}}</h2>
+                <span class="chart-note">{{.Span}}; change is this {{.Period}} so far against the same part of the last</span>
+            </div>
+            <table class="trends">
+                <tr>
+                    <th>{{if eq .By "category"}}Category{{else}}Application{{end}}</th>
+                    <th>Per {{.Period}}</th>
+                    <th>This {{.Period}}</th>
+                    <th>Change</th>
+                </tr>
+                {{range .Series}}
+                <tr>
+                    <td class="key">{{.Key}}</td>
+                    <td><svg width="240" height="40"><polyline points="{{.Points}}"></polyline></svg></td>
+                    <td>{{printf "%.0f" .Current}} min</td>
+                    <td{{if .Change}} class="{{if .Up}}up{{else}}down{{end}}"{{end}}>{{if .Change}}{{.Change}}{{else}}-{{end}}</td>
+                </tr>
+                {{else}}
+                <tr><td colspan="4">Nothing was recorded in this time.</td></tr>
+                {{end}}
+            </table>
+        </div>
+    </div>
+</body>
+</html>
+`
+
+// handleTrends serves the heatmap and the trends, configured by the form
+// on the page.
+func (v *Visualizer) handleTrends(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	day := v.storage.Day()
+	now := time.Now()
+
+	data := TrendsData{
+		From:    params.Get("from"),
+		To:      params.Get("to"),
+		App:     params.Get("app"),
+		Period:  params.Get("period"),
+		By:      params.Get("by"),
+		Periods: 8,
+	}
+	// The heatmap covers the last four weeks unless asked otherwise
+	if data.From == "" {
+		data.From = day.Start(now).AddDate(0, 0, -27).Format("2006-01-02")
+	}
+	if data.To == "" {
+		data.To = day.Start(now).Format("2006-01-02")
+	}
+	from, err := day.ParseTime(data.From, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := day.ParseTime(data.To, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !to.After(from) {
+		http.Error(w, "the range must end after it starts", http.StatusBadRequest)
+		return
+	}
+	q := storage.Query{From: from, To: to}
+	if data.App != "" {
+		if q.App, err = regexp.Compile(data.App); err != nil {
+			http.Error(w, fmt.Sprintf("invalid application pattern: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	period, err := ParsePeriod(data.Period)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data.Period = string(period)
+	if period == Month {
+		data.Periods = 6
+	}
+	if s := params.Get("periods"); s != "" {
+		if data.Periods, err = strconv.Atoi(s); err != nil || data.Periods < 2 || data.Periods > 52 {
+			http.Error(w, "periods must be between 2 and 52", http.StatusBadRequest)
+			return
+		}
+	}
+	switch data.By {
+	case "", "app":
+		data.By = "app"
+		q.GroupBy = storage.GroupByApp
+	case "category":
+		q.GroupBy = storage.GroupByCategory
+	default:
+		http.Error(w, fmt.Sprintf("unknown trend grouping %q", data.By), http.StatusBadRequest)
+		return
+	}
+
+	heatmap, err := BuildHeatmap(v.storage, q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	trends, err := BuildTrends(v.storage, q, period, data.Periods, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Range = fmt.Sprintf("%s to %s, %.1f hours",
+		from.Format("2 Jan 2006"), to.Add(-time.Nanosecond).Format("2 Jan 2006"), heatmap.Total().Hours())
+	data.Hours, data.Heatmap = heatmapRows(heatmap)
+	data.Span, data.Series = seriesRows(trends)
+
+	tmpl, err := template.New("trends").Parse(trendsTemplate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var weekdays = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// heatmapRows converts a heatmap into view data.
+func heatmapRows(h *Heatmap) ([]int, []HeatmapRow) {
+	hours := make([]int, 24)
+	for i := range hours {
+		hours[i] = i
+	}
+	rows := make([]HeatmapRow, 7)
+	for d, cells := range h.Cells {
+		rows[d].Day = weekdays[d]
+		for hour, cell := range cells {
+			var level float64
+			if h.Max > 0 {
+				level = float64(cell) / float64(h.Max)
+			}
+			rows[d].Cells = append(rows[d].Cells, HeatmapCell{
+				Label: fmt.Sprintf("%s %02d:00: %.0f min", weekdays[d], hour, cell.Minutes()),
+				Level: level,
+			})
+		}
+	}
+	return hours, rows
+}
+
+// seriesRows converts the longest series of a trend report into view data,
+// and describes the periods they span.
+func seriesRows(report *TrendReport) (string, []SeriesRow) {
+	span := fmt.Sprintf("%d weeks from %s", len(report.Starts), report.Starts[0].Format("2 Jan 2006"))
+	if report.Period == Month {
+		span = fmt.Sprintf("%d months from %s", len(report.Starts), report.Starts[0].Format("January 2006"))
+	}
+
+	series := report.Series
+	if len(series) > trendSeries {
+		series = series[:trendSeries]
+	}
+	rows := make([]SeriesRow, len(series))
+	for i, s := range series {
+		rows[i] = SeriesRow{
+			Key:     s.Key,
+			Points:  sparkline(s.Durations),
+			Current: s.Durations[len(s.Durations)-1].Minutes(),
+		}
+		if s.HasChange {
+			rows[i].Change = fmt.Sprintf("%+.0f%%", s.Change)
+			rows[i].Up = s.Change >= 0
+		}
+	}
+	return span, rows
+}
+
+// sparkline returns the points of a line through durations, scaled to the
+// largest.
+func sparkline(durations []time.Duration) string {
+	var max time.Duration
+	for _, d := range durations {
+		if d > max {
+			max = d
+		}
+	}
+	points := make([]string, len(durations))
+	for i, d := range durations {
+		x := 0.0
+		if len(durations) > 1 {
+			x = float64(i) * sparklineWidth / float64(len(durations)-1)
+		}
+		y := float64(sparklineHeight - 2)
+		if max > 0 {
+			y -= float64(d) / float64(max) * (sparklineHeight - 4)
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " ")
+}
@@ -1,33 +1,171 @@
 package analytics
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
 	"html/template"
+	"log"
+	"net"
 	"net/http"
-	"sort"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/windowmonitor/pkg/storage"
 )
 
+const (
+	// defaultTopN is how many entries the dashboard lists by default
+	defaultTopN = 10
+	maxTopN     = 100
+)
+
 type Visualizer struct {
-	storage *storage.Storage
+	storage      storage.Storage
+	eraser       *storage.Eraser
+	productivity *Productivity
+	live         LiveSource
+	// token is chosen at random by StartServer and must be posted with
+	// forget requests, so only pages served by this run can send them
+	token string
 }
 
-func NewVisualizer(storage *storage.Storage) *Visualizer {
+func NewVisualizer(storage storage.Storage) *Visualizer {
 	return &Visualizer{storage: storage}
 }
 
+// SetEraser enables the dashboard's forget action, which deletes history
+// through eraser.
+func (v *Visualizer) SetEraser(eraser storage.Eraser) {
+	v.eraser = &eraser
+}
+
+// SetProductivity shows the productivity score of the day and its trend
+// on the dashboard.
+func (v *Visualizer) SetProductivity(productivity *Productivity) {
+	v.productivity = productivity
+}
+
+// StartServer serves the dashboard and the JSON API under /api/v1. addr
+// should be a loopback address, since the history is served without
+// authentication. Requests from other machines, or naming any other host,
+// are refused.
 func (v *Visualizer) StartServer(addr string) error {
-	http.HandleFunc("/", v.handleDashboard)
-	http.HandleFunc("/data", v.handleData)
-	return http.ListenAndServe(addr, nil)
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate token: %v", err)
+	}
+	v.token = hex.EncodeToString(token)
+	return http.ListenAndServe(addr, v.handler())
+}
+
+// handler routes the dashboard and API requests that pass the loopback
+// checks.
+func (v *Visualizer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", v.handleDashboard)
+	mux.HandleFunc("/data", v.handleData)
+	mux.HandleFunc("/forget", v.handleForget)
+	mux.HandleFunc("/timeline", v.handleTimeline)
+	mux.HandleFunc("/trends", v.handleTrends)
+	mux.HandleFunc("/events", v.handleEvents)
+	v.registerAPI(mux)
+	return loopbackHost(loopbackClient(mux))
+}
+
+// loopbackHost refuses requests whose Host header does not name the local
+// machine. A site that rebinds its DNS name to 127.0.0.1 still sends its
+// own name, so it cannot read the history through the user's browser.
+func loopbackHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if ip := net.ParseIP(host); !strings.EqualFold(host, "localhost") && (ip == nil || !ip.IsLoopback()) {
+			http.Error(w, "requests must be addressed to localhost", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackClient refuses requests that do not come from the local machine,
+// whatever address the server listens on.
+func loopbackClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "requests must come from the local machine", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 type ViewData struct {
-	Stats []StatData
+	// Day describes the day the stats cover, such as "Saturday 17 October
+	// 2026, from 04:00 (Europe/Berlin)".
+	Day             string
+	Stats           StatList
+	Apps            StatList
+	Categories      StatList
+	HideInterrupted bool
+	// Search and N are the window search and the number of entries shown
+	// per list
+	Search string
+	N      int
+	// PrevURL and NextURL page through the windows, if there are more
+	PrevURL, NextURL string
+	// CanForget shows the controls for deleting history, which post
+	// Token with the form
+	CanForget bool
+	Token     string
+	// Notice reports the result of the last action
+	Notice string
+	// Productivity is set when categories are rated
+	Productivity *ProductivityData
+	// Live shows the focused window and keeps the page up to date
+	Live bool
+}
+
+// ProductivityData is the productivity score of the day and the days
+// before it.
+type ProductivityData struct {
+	Summary     string
+	Productive  float64
+	Neutral     float64
+	Distracting float64
+	Days        []DayScore
+}
+
+// DayScore is the score of one day in the trend.
+type DayScore struct {
+	Label string
+	Value float64
+	// Active is false for days without activity
+	Active bool
+}
+
+// StatList is a page of entries, followed by the rest added up as Other.
+// Percentages are shares of all time tracked today.
+type StatList struct {
+	Rows  []StatData
+	Other *StatData
+	// Page counts from 1
+	Page, Pages int
+	// Matched and MatchedMinutes describe all entries, not just the page
+	Matched        int
+	MatchedMinutes float64
 }
 
 type StatData struct {
 	Title      string
+	App        string
 	Minutes    float64
 	Percentage float64
 }
@@ -67,11 +205,148 @@ const dashboardTemplate = `
             padding: 20px 0;
             border-bottom: 1px solid var(--border-color);
             margin-bottom: 24px;
+            display: flex;
+            justify-content: space-between;
+            align-items: baseline;
         }
         .header h1 {
             font-size: 24px;
             font-weight: 500;
         }
+        .header-day {
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        .header a {
+            color: var(--accent-color);
+            font-size: 14px;
+            text-decoration: none;
+        }
+        .header-links a + a {
+            margin-left: 16px;
+        }
+        .notice {
+            background-color: var(--bg-secondary);
+            border-left: 3px solid var(--accent-color);
+            border-radius: 4px;
+            padding: 12px 16px;
+            margin-bottom: 24px;
+        }
+        .stat-details form {
+            display: inline;
+        }
+        .forget-button {
+            background: none;
+            border: none;
+            color: var(--text-secondary);
+            cursor: pointer;
+            font-size: 12px;
+            margin-left: 12px;
+        }
+        .forget-button:hover {
+            color: #f14c4c;
+        }
+        .forget-form {
+            display: grid;
+            grid-template-columns: repeat(auto-fill, minmax(200px, 1fr));
+            gap: 12px;
+            align-items: end;
+        }
+        .forget-form label {
+            display: flex;
+            flex-direction: column;
+            gap: 4px;
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        .forget-form input {
+            background-color: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            color: var(--text-primary);
+            padding: 6px 8px;
+        }
+        .forget-form button {
+            background-color: #a1260d;
+            border: none;
+            border-radius: 4px;
+            color: var(--text-primary);
+            cursor: pointer;
+            padding: 8px 12px;
+        }
+        .score {
+            display: flex;
+            align-items: baseline;
+            gap: 24px;
+            margin-bottom: 20px;
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        .score-value {
+            font-size: 20px;
+            color: var(--text-primary);
+        }
+        .trend {
+            display: grid;
+            grid-template-columns: repeat(7, 1fr);
+            gap: 8px;
+            align-items: end;
+            height: 120px;
+        }
+        .trend-day {
+            display: flex;
+            flex-direction: column;
+            justify-content: flex-end;
+            height: 100%;
+            text-align: center;
+            font-size: 12px;
+            color: var(--text-secondary);
+        }
+        .trend-bar {
+            background-color: var(--accent-color);
+            border-radius: 3px 3px 0 0;
+            min-height: 2px;
+        }
+        .live-title {
+            font-size: 18px;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        .live-details, .live-timer {
+            color: var(--text-secondary);
+            font-size: 14px;
+        }
+        .live-timer {
+            font-variant-numeric: tabular-nums;
+        }
+        .search input {
+            background-color: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            color: var(--text-primary);
+            padding: 4px 8px;
+            width: 240px;
+        }
+        .list-note {
+            color: var(--text-secondary);
+            font-size: 14px;
+            margin-bottom: 12px;
+        }
+        .stat-item.other .progress-fill {
+            background-color: var(--text-secondary);
+        }
+        .pager {
+            display: flex;
+            justify-content: space-between;
+            margin-top: 16px;
+            font-size: 14px;
+            color: var(--text-secondary);
+        }
+        .pager a {
+            color: var(--accent-color);
+            text-decoration: none;
+        }
         .chart {
             background-color: var(--bg-secondary);
             border-radius: 8px;
@@ -89,6 +364,9 @@ const dashboardTemplate = `
             font-weight: 500;
             color: var(--text-primary);
         }
+        .chart + .chart {
+            margin-top: 24px;
+        }
         .stats-grid {
             display: grid;
             gap: 12px;
@@ -161,15 +439,95 @@ const dashboardTemplate = `
 <body>
     <div class="container">
         <div class="header">
-            <h1>Window Usage Analytics</h1>
+            <div>
+                <h1>Window Usage Analytics</h1>
+                <div class="header-day">{{.Day}}</div>
+            </div>
+            <div class="header-links">
+                <a href="/timeline">Timeline</a>
+                <a href="/trends">Trends</a>
+                {{if .HideInterrupted}}
+                <a href="/">Show interrupted sessions</a>
+                {{else}}
+                <a href="/?interrupted=hide">Hide interrupted sessions</a>
+                {{end}}
+            </div>
         </div>
-        <div class="chart">
+        {{if .Notice}}
+        <div class="notice">{{.Notice}}</div>
+        {{end}}
+        {{if .Live}}
+        <div class="chart live">
+            <div class="chart-header">
+                <h2 class="chart-title">Now</h2>
+                <span class="live-timer" id="live-timer"></span>
+            </div>
+            <div class="live-title" id="live-title">Connecting...</div>
+            <div class="live-details" id="live-details"></div>
+        </div>
+        {{end}}
+        {{with .Productivity}}
+        <div class="chart" id="productivity" data-refresh>
+            <div class="chart-header">
+                <h2 class="chart-title">Productivity (Today)</h2>
+            </div>
+            <div class="score">
+                <span class="score-value">{{.Summary}}</span>
+                <span>{{printf "%.0f" .Productive}} min productive</span>
+                <span>{{printf "%.0f" .Neutral}} min neutral</span>
+                <span>{{printf "%.0f" .Distracting}} min distracting</span>
+            </div>
+            <div class="trend">
+                {{range .Days}}
+                <div class="trend-day">
+                    {{if .Active}}<span>{{printf "%.0f" .Value}}</span>
+                    <div class="trend-bar" style="height: {{.Value}}%;"></div>{{else}}<span>-</span>{{end}}
+                    <span>{{.Label}}</span>
+                </div>
+                {{end}}
+            </div>
+        </div>
+        {{end}}
+        <div class="chart" id="windows" data-refresh>
             <div class="chart-header">
-                <h2 class="chart-title">Most Active Windows (Last 24 Hours)</h2>
+                <h2 class="chart-title">Most Active Windows (Today)</h2>
+                <form class="search" method="get" action="/">
+                    <input type="search" name="q" value="{{.Search}}" placeholder="Search windows">
+                    <input type="hidden" name="n" value="{{.N}}">
+                    {{if .HideInterrupted}}<input type="hidden" name="interrupted" value="hide">{{end}}
+                </form>
             </div>
+            {{if .Search}}
+            <div class="list-note">{{.Stats.Matched}} windows match &ldquo;{{.Search}}&rdquo;, {{printf "%.1f" .Stats.MatchedMinutes}} min in all</div>
+            {{end}}
             <div class="stats-grid">
-                {{range .Stats}}
+                {{range .Stats.Rows}}
                 <div class="stat-item">
+                    <div class="stat-header">
+                        <div class="stat-title">{{.Title}}</div>
+                        <div class="stat-time">{{printf "%.1f" .Minutes}} min</div>
+                    </div>
+                    <div class="progress-bar">
+                        <div class="progress-fill" style="width: {{.Percentage}}%;"></div>
+                    </div>
+                    <div class="stat-details">
+                        <span>{{if .App}}{{.App}}{{else}}Usage{{end}}</span>
+                        <span>{{printf "%.1f" .Percentage}}%
+                            {{- if $.CanForget}}
+                            <form method="post" action="/forget" onsubmit="return confirm('Forget all history of this window, including backups?')">
+                                <input type="hidden" name="token" value="{{$.Token}}">
+                                <input type="hidden" name="title" value="{{.Title}}">
+                                <button class="forget-button" type="submit">Forget</button>
+                            </form>
+                            {{- end}}
+                        </span>
+                    </div>
+                </div>
+                {{else}}
+                <div class="list-note">{{if .Search}}No window matches.{{else}}Nothing was recorded today.{{end}}</div>
+                {{end}}
+                {{with .Stats.Other}}
+                <div class="stat-item other">
                     <div class="stat-header">
                         <div class="stat-title">{{.Title}}</div>
                         <div class="stat-time">{{printf "%.1f" .Minutes}} min</div>
@@ -184,47 +542,255 @@ const dashboardTemplate = `
                 </div>
                 {{end}}
             </div>
+            {{if gt .Stats.Pages 1}}
+            <div class="pager">
+                {{if .PrevURL}}<a href="{{.PrevURL}}">&larr; Previous</a>{{else}}<span></span>{{end}}
+                <span>Page {{.Stats.Page}} of {{.Stats.Pages}}</span>
+                {{if .NextURL}}<a href="{{.NextURL}}">Next &rarr;</a>{{else}}<span></span>{{end}}
+            </div>
+            {{end}}
         </div>
+        <div class="chart" id="apps" data-refresh>
+            <div class="chart-header">
+                <h2 class="chart-title">Most Active Applications (Today)</h2>
+            </div>
+            <div class="stats-grid">
+                {{range .Apps.Rows}}
+                <div class="stat-item">
+                    <div class="stat-header">
+                        <div class="stat-title">{{.Title}}</div>
+                        <div class="stat-time">{{printf "%.1f" .Minutes}} min</div>
+                    </div>
+                    <div class="progress-bar">
+                        <div class="progress-fill" style="width: {{.Percentage}}%;"></div>
+                    </div>
+                    <div class="stat-details">
+                        <span>Usage</span>
+                        <span>{{printf "%.1f" .Percentage}}%
+                            {{- if $.CanForget}}
+                            <form method="post" action="/forget" onsubmit="return confirm('Forget all history of this application, including backups?')">
+                                <input type="hidden" name="token" value="{{$.Token}}">
+                                <input type="hidden" name="app" value="{{.Title}}">
+                                <button class="forget-button" type="submit">Forget</button>
+                            </form>
+                            {{- end}}
+                        </span>
+                    </div>
+                </div>
+                {{end}}
+                {{with .Apps.Other}}
+                <div class="stat-item other">
+                    <div class="stat-header">
+                        <div class="stat-title">{{.Title}}</div>
+                        <div class="stat-time">{{printf "%.1f" .Minutes}} min</div>
+                    </div>
+                    <div class="progress-bar">
+                        <div class="progress-fill" style="width: {{.Percentage}}%;"></div>
+                    </div>
+                    <div class="stat-details">
+                        <span>Usage</span>
+                        <span>{{printf "%.1f" .Percentage}}%</span>
+                    </div>
+                </div>
+                {{end}}
+            </div>
+        </div>
+        <div class="chart" id="categories" data-refresh>
+            <div class="chart-header">
+                <h2 class="chart-title">Categories (Today)</h2>
+            </div>
+            <div class="stats-grid">
+                {{range .Categories.Rows}}
+                <div class="stat-item">
+                    <div class="stat-header">
+                        <div class="stat-title">{{.Title}}</div>
+                        <div class="stat-time">{{printf "%.1f" .Minutes}} min</div>
+                    </div>
+                    <div class="progress-bar">
+                        <div class="progress-fill" style="width: {{.Percentage}}%;"></div>
+                    </div>
+                    <div class="stat-details">
+                        <span>Usage</span>
+                        <span>{{printf "%.1f" .Percentage}}%</span>
+                    </div>
+                </div>
+                {{end}}
+                {{with .Categories.Other}}
+                <div class="stat-item other">
+                    <div class="stat-header">
+                        <div class="stat-title">{{.Title}}</div>
+                        <div class="stat-time">{{printf "%.1f" .Minutes}} min</div>
+                    </div>
+                    <div class="progress-bar">
+                        <div class="progress-fill" style="width: {{.Percentage}}%;"></div>
+                    </div>
+                    <div class="stat-details">
+                        <span>Usage</span>
+                        <span>{{printf "%.1f" .Percentage}}%</span>
+                    </div>
+                </div>
+                {{end}}
+            </div>
+        </div>
+        {{if .CanForget}}
+        <div class="chart">
+            <div class="chart-header">
+                <h2 class="chart-title">Forget History</h2>
+            </div>
+            <form class="forget-form" method="post" action="/forget" onsubmit="return confirm('Permanently delete the matching history, including backups?')">
+                <input type="hidden" name="token" value="{{.Token}}">
+                <label>Window title<input type="text" name="title"></label>
+                <label>Title pattern<input type="text" name="title_regex" placeholder="regular expression"></label>
+                <label>Application<input type="text" name="app"></label>
+                <label>From<input type="date" name="from"></label>
+                <label>To<input type="date" name="to"></label>
+                <button type="submit">Forget</button>
+            </form>
+        </div>
+        {{end}}
     </div>
+    {{if .Live}}
+    <script>
+        const stateNames = {idle: 'Idle', locked: 'Locked', asleep: 'Asleep'};
+        const liveTitle = document.getElementById('live-title');
+        const liveDetails = document.getElementById('live-details');
+        const liveTimer = document.getElementById('live-timer');
+        let since = null;
+
+        function showTimer() {
+            if (!since) {
+                liveTimer.textContent = '';
+                return;
+            }
+            const seconds = Math.max(0, Math.floor((Date.now() - since) / 1000));
+            const h = Math.floor(seconds / 3600);
+            const m = String(Math.floor(seconds / 60) % 60).padStart(2, '0');
+            const s = String(seconds % 60).padStart(2, '0');
+            liveTimer.textContent = (h > 0 ? h + ':' : '') + m + ':' + s;
+        }
+
+        // The totals are re-rendered by the server rather than duplicated
+        // here, a moment after each saved session
+        let refresh = null;
+        async function refreshTotals() {
+            const response = await fetch(location.href);
+            if (!response.ok) return;
+            const page = new DOMParser().parseFromString(await response.text(), 'text/html');
+            document.querySelectorAll('[data-refresh]').forEach(section => {
+                const fresh = page.getElementById(section.id);
+                // Leave a section alone while its search box is in use
+                if (fresh && !section.contains(document.activeElement)) section.replaceWith(fresh);
+            });
+        }
+
+        const events = new EventSource('/events');
+        events.addEventListener('status', e => {
+            const status = JSON.parse(e.data);
+            since = new Date(status.since);
+            if (status.state !== 'active') {
+                liveTitle.textContent = stateNames[status.state] || status.state;
+                liveDetails.textContent = 'Not counted towards window usage';
+            } else if (status.hidden) {
+                liveTitle.textContent = 'Private window';
+                liveDetails.textContent = 'Hidden by the privacy rules';
+            } else if (status.title) {
+                liveTitle.textContent = status.title;
+                liveDetails.textContent = status.app + (status.category ? ' - ' + status.category : '');
+            } else {
+                liveTitle.textContent = 'No window';
+                liveDetails.textContent = '';
+                since = null;
+            }
+            showTimer();
+        });
+        events.addEventListener('session', () => {
+            clearTimeout(refresh);
+            refresh = setTimeout(refreshTotals, 1000);
+        });
+        events.onerror = () => {
+            liveTitle.textContent = 'Reconnecting...';
+            liveDetails.textContent = '';
+            since = null;
+            showTimer();
+        };
+        setInterval(showTimer, 1000);
+    </script>
+    {{end}}
 </body>
 </html>
 `
 
 func (v *Visualizer) handleDashboard(w http.ResponseWriter, r *http.Request) {
-	stats, err := v.storage.GetDailyStats()
+	params := r.URL.Query()
+	// Sessions that span a suspend or clock change are shown unless asked
+	hideInterrupted := params.Get("interrupted") == "hide"
+	var filters []storage.StatsFilter
+	if hideInterrupted {
+		filters = append(filters, storage.SkipInterrupted)
+	}
+	n, err := intParam(params.Get("n"), defaultTopN)
+	if err != nil || n < 1 || n > maxTopN {
+		http.Error(w, fmt.Sprintf("n must be between 1 and %d", maxTopN), http.StatusBadRequest)
+		return
+	}
+	page, err := intParam(params.Get("page"), 1)
+	if err != nil || page < 1 {
+		http.Error(w, "page must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	search := strings.TrimSpace(params.Get("q"))
+
+	stats, err := v.storage.GetDailyStats(filters...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Sort stats by duration
-	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].Duration > stats[j].Duration
-	})
-
-	// Take top 10 most used windows
-	if len(stats) > 10 {
-		stats = stats[:10]
+	apps, err := v.storage.GetDailyAppStats(filters...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	categories, err := v.storage.GetDailyCategoryStats(filters...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// Calculate total duration and prepare view data
-	var totalDuration float64
+	// Shares are of everything tracked today, whatever is shown
+	var total time.Duration
 	for _, stat := range stats {
-		totalDuration += stat.Duration.Minutes()
+		total += stat.Duration
 	}
 
 	viewData := ViewData{
-		Stats: make([]StatData, len(stats)),
+		Day:             describeDay(v.storage.Day(), time.Now()),
+		Stats:           statList(searchStats(stats, search), total, page, n, true),
+		Apps:            statList(apps, total, 1, n, false),
+		Categories:      statList(categories, total, 1, n, false),
+		HideInterrupted: hideInterrupted,
+		Search:          search,
+		N:               n,
+		Live:            v.live != nil,
+		CanForget:       v.eraser != nil,
+		Token:           v.token,
 	}
-
-	for i, stat := range stats {
-		minutes := stat.Duration.Minutes()
-		percentage := (minutes / totalDuration) * 100
-		viewData.Stats[i] = StatData{
-			Title:      stat.Title,
-			Minutes:    minutes,
-			Percentage: percentage,
+	page = viewData.Stats.Page
+	if page > 1 {
+		viewData.PrevURL = pageURL(r, page-1)
+	}
+	if page < viewData.Stats.Pages {
+		viewData.NextURL = pageURL(r, page+1)
+	}
+	if v.productivity != nil {
+		trend, err := v.productivity.Trend(time.Now(), 7, filters...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		viewData.Productivity = productivityData(trend)
+	}
+	if forgot := r.URL.Query().Get("forgot"); forgot != "" {
+		viewData.Notice = fmt.Sprintf("Forgot %s sessions.", forgot)
 	}
 
 	// Parse and execute template
@@ -241,7 +807,200 @@ func (v *Visualizer) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// describeDay names the day containing now and when it started.
+func describeDay(day storage.Day, now time.Time) string {
+	start := day.Start(now)
+	return fmt.Sprintf("%s, from %s (%s)",
+		start.Format("Monday 2 January 2006"), start.Format("15:04"), start.Location())
+}
+
+// productivityData converts a trend ending today into view data.
+func productivityData(trend Trend) *ProductivityData {
+	today := trend.Last()
+	data := &ProductivityData{
+		Summary:     trend.Describe(),
+		Productive:  today.Productive.Minutes(),
+		Neutral:     today.Neutral.Minutes(),
+		Distracting: today.Distracting.Minutes(),
+	}
+	for _, score := range trend {
+		data.Days = append(data.Days, DayScore{
+			Label:  score.Day.Format("Mon 2"),
+			Value:  score.Value(),
+			Active: score.Total() > 0,
+		})
+	}
+	return data
+}
+
+// searchStats returns the entries whose title or application contains
+// search, ignoring case.
+func searchStats(stats []storage.WindowStats, search string) []storage.WindowStats {
+	if search == "" {
+		return stats
+	}
+	search = strings.ToLower(search)
+	var matched []storage.WindowStats
+	for _, stat := range stats {
+		if strings.Contains(strings.ToLower(stat.Title), search) ||
+			strings.Contains(strings.ToLower(stat.AppName()), search) {
+			matched = append(matched, stat)
+		}
+	}
+	return matched
+}
+
+// statList converts one page of n entries of stats, which are ordered
+// longest first, into view data, with the entries after the page added up
+// as Other. Pages count from 1, and a page past the end shows the last
+// one. Percentages are shares of total. When withApp is set each row also
+// names the application that owned it.
+func statList(stats []storage.WindowStats, total time.Duration, pageNo, n int, withApp bool) StatList {
+	list := StatList{
+		Pages:   (len(stats) + n - 1) / n,
+		Matched: len(stats),
+	}
+	// Links to later pages outlive forgetting history or a new search
+	if pageNo > list.Pages {
+		pageNo = max(list.Pages, 1)
+	}
+	list.Page = pageNo
+	share := func(d time.Duration) float64 {
+		if total <= 0 {
+			return 0
+		}
+		return float64(d) / float64(total) * 100
+	}
+
+	var matched time.Duration
+	for _, stat := range stats {
+		matched += stat.Duration
+	}
+	list.MatchedMinutes = matched.Minutes()
+
+	offset := (pageNo - 1) * n
+	rows := storage.Page(stats, offset, n)
+	for _, stat := range rows {
+		data := StatData{
+			Title:      stat.Title,
+			Minutes:    stat.Duration.Minutes(),
+			Percentage: share(stat.Duration),
+		}
+		if withApp {
+			data.App = stat.AppName()
+		}
+		list.Rows = append(list.Rows, data)
+	}
+
+	// Entries on earlier pages are not counted again
+	if rest := len(stats) - offset - len(rows); rest > 0 {
+		var other time.Duration
+		for _, stat := range stats[len(stats)-rest:] {
+			other += stat.Duration
+		}
+		list.Other = &StatData{
+			Title:      fmt.Sprintf("Other (%d more)", rest),
+			Minutes:    other.Minutes(),
+			Percentage: share(other),
+		}
+	}
+	return list
+}
+
+// pageURL returns the dashboard URL of r with the page parameter changed.
+func pageURL(r *http.Request, page int) string {
+	params := r.URL.Query()
+	params.Set("page", strconv.Itoa(page))
+	params.Del("forgot")
+	return "/?" + params.Encode()
+}
+
+// handleForget deletes the history selected by a posted form and returns to
+// the dashboard.
+func (v *Visualizer) handleForget(w http.ResponseWriter, r *http.Request) {
+	if v.eraser == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Other sites must not be able to post forms to the local server
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	if v.token == "" || subtle.ConstantTimeCompare([]byte(r.PostFormValue("token")), []byte(v.token)) != 1 {
+		http.Error(w, "missing or invalid token; reload the dashboard", http.StatusForbidden)
+		return
+	}
+
+	sel, err := parseSelector(r, v.storage.Day())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := v.eraser.Forget(sel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Forgot %s: %d sessions, %d backups", sel, report.Sessions, report.Backups)
+	for _, path := range report.Leftovers {
+		log.Printf("Forget: %s may still hold matching history", path)
+	}
+	http.Redirect(w, r, fmt.Sprintf("/?forgot=%d", report.Sessions), http.StatusSeeOther)
+}
+
+// parseSelector reads a forget selector from form values. Dates are whole
+// days, so to covers the day it names.
+func parseSelector(r *http.Request, day storage.Day) (storage.Selector, error) {
+	sel := storage.Selector{
+		Title: r.FormValue("title"),
+		App:   r.FormValue("app"),
+	}
+	if pattern := r.FormValue("title_regex"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return sel, fmt.Errorf("invalid title pattern: %v", err)
+		}
+		sel.TitlePattern = re
+	}
+	var err error
+	if from := r.FormValue("from"); from != "" {
+		if sel.From, err = day.ParseTime(from, false); err != nil {
+			return sel, err
+		}
+	}
+	if to := r.FormValue("to"); to != "" {
+		if sel.To, err = day.ParseTime(to, true); err != nil {
+			return sel, err
+		}
+	}
+	if sel.IsZero() {
+		return sel, fmt.Errorf("nothing selected to forget")
+	}
+	return sel, nil
+}
+
+// sameOrigin reports whether a request came from the dashboard itself.
+// Requests without an Origin header pass, and rely on the token.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// handleData is the old data endpoint, now answered by the stats API.
 func (v *Visualizer) handleData(w http.ResponseWriter, r *http.Request) {
-	// Redirect to dashboard since we're not using AJAX anymore
-	http.Redirect(w, r, "/", http.StatusFound)
+	target := "/api/v1/stats"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
 }
@@ -0,0 +1,148 @@
+package analytics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// newTestVisualizer returns a visualizer over a file storage holding one
+// session of title today, with forgetting enabled.
+func newTestVisualizer(t *testing.T, title string) (*Visualizer, storage.Storage) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := storage.NewFileStorage(filepath.Join(dir, "window_stats.json"))
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.SaveWindowStats(storage.WindowStats{Title: title, Process: "app.exe", Duration: time.Second}); err != nil {
+		t.Fatalf("SaveWindowStats: %v", err)
+	}
+	v := NewVisualizer(db)
+	v.SetEraser(storage.Eraser{Storage: db, Dir: dir})
+	v.token = "run-token"
+	return v, db
+}
+
+func TestLoopbackHost(t *testing.T) {
+	handler := loopbackHost(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range []struct {
+		host string
+		want int
+	}{
+		{"localhost:8080", http.StatusOK},
+		{"LOCALHOST", http.StatusOK},
+		{"127.0.0.1:8080", http.StatusOK},
+		{"[::1]:8080", http.StatusOK},
+		{"[::1]", http.StatusOK},
+		{"attacker.example:8080", http.StatusForbidden},
+		{"localhost.attacker.example", http.StatusForbidden},
+		{"192.168.1.20:8080", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("Host %s: status %d, want %d", tt.host, w.Code, tt.want)
+		}
+	}
+}
+
+func TestForgetToken(t *testing.T) {
+	v, db := newTestVisualizer(t, "Secret")
+
+	// The dashboard's forms carry the token
+	w := httptest.NewRecorder()
+	v.handleDashboard(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(w.Body.String(), `name="token" value="run-token"`) {
+		t.Fatal("dashboard forms do not carry the token")
+	}
+
+	post := func(form url.Values, origin string) int {
+		r := httptest.NewRequest(http.MethodPost, "/forget", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		v.handleForget(w, r)
+		return w.Code
+	}
+	for _, tt := range []struct {
+		name   string
+		token  string
+		origin string
+	}{
+		{"no token", "", ""},
+		{"wrong token", "guess", ""},
+		{"other origin", "run-token", "http://attacker.example"},
+	} {
+		form := url.Values{"title": {"Secret"}}
+		if tt.token != "" {
+			form.Set("token", tt.token)
+		}
+		if code := post(form, tt.origin); code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want %d", tt.name, code, http.StatusForbidden)
+		}
+	}
+	if stats, _ := db.GetDailyStats(); len(stats) != 1 {
+		t.Fatalf("refused requests changed the history: %+v", stats)
+	}
+
+	form := url.Values{"title": {"Secret"}, "token": {"run-token"}}
+	if code := post(form, "http://example.com"); code != http.StatusSeeOther {
+		t.Errorf("forget with the token: status %d, want %d", code, http.StatusSeeOther)
+	}
+	if stats, _ := db.GetDailyStats(); len(stats) != 0 {
+		t.Errorf("history after forgetting: %+v", stats)
+	}
+}
+
+func TestStatListPastTheEnd(t *testing.T) {
+	var stats []storage.WindowStats
+	for i := 0; i < 25; i++ {
+		stats = append(stats, storage.WindowStats{Title: fmt.Sprintf("Window %d", i), Duration: time.Minute})
+	}
+	for _, tt := range []struct {
+		stats      []storage.WindowStats
+		page       int
+		wantPage   int
+		wantRows   int
+		wantPages  int
+		wantOthers bool
+	}{
+		{stats, 1, 1, 10, 3, true},
+		{stats, 3, 3, 5, 3, false},
+		{stats, 4, 3, 5, 3, false},
+		{stats, 99, 3, 5, 3, false},
+		{nil, 2, 1, 0, 0, false},
+	} {
+		list := statList(tt.stats, time.Hour, tt.page, 10, false)
+		if list.Page != tt.wantPage || len(list.Rows) != tt.wantRows || list.Pages != tt.wantPages || (list.Other != nil) != tt.wantOthers {
+			t.Errorf("page %d of %d entries: page %d of %d with %d rows, other %v",
+				tt.page, len(tt.stats), list.Page, list.Pages, len(list.Rows), list.Other)
+		}
+	}
+}
+
+func TestDashboardPagePastTheEnd(t *testing.T) {
+	v, _ := newTestVisualizer(t, "Report")
+	w := httptest.NewRecorder()
+	v.handleDashboard(w, httptest.NewRequest(http.MethodGet, "/?page=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "Nothing was recorded today") || !strings.Contains(body, "Report") {
+		t.Error("a page past the end does not show the last page")
+	}
+}
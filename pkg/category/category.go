@@ -0,0 +1,172 @@
+// Package category assigns categories and tags to window sessions
+// according to rules from a file, so that usage can be added up by
+// activity rather than by window title.
+package category
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/windowmonitor/pkg/rulesfile"
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// Rule matches sessions by application name, window class and title, all
+// regular expressions that match anywhere unless anchored. An empty matcher
+// matches everything.
+type Rule struct {
+	App      string   `json:"app,omitempty"`
+	Class    string   `json:"class,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Priority orders the rules, highest first. Rules of equal priority
+	// keep their order in the file.
+	Priority int `json:"priority,omitempty"`
+
+	app, class, title *regexp.Regexp
+}
+
+// Rules assign to a session the category of the first matching rule that
+// has one, and the tags of every matching rule.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Parse reads and compiles rules in their JSON form.
+func Parse(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse category rules: %v", err)
+	}
+	for i := range rules.Rules {
+		if err := rules.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("category rule %d: %v", i+1, err)
+		}
+	}
+	sort.SliceStable(rules.Rules, func(i, j int) bool {
+		return rules.Rules[i].Priority > rules.Rules[j].Priority
+	})
+	return &rules, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Category == "" && len(r.Tags) == 0 {
+		return fmt.Errorf("rule sets neither a category nor tags")
+	}
+	var err error
+	if r.app, err = compile(r.App); err != nil {
+		return fmt.Errorf("invalid app pattern: %v", err)
+	}
+	if r.class, err = compile(r.Class); err != nil {
+		return fmt.Errorf("invalid class pattern: %v", err)
+	}
+	if r.title, err = compile(r.Title); err != nil {
+		return fmt.Errorf("invalid title pattern: %v", err)
+	}
+	return nil
+}
+
+func compile(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+func (r *Rule) matches(stat storage.WindowStats) bool {
+	if r.app != nil && !r.app.MatchString(stat.AppName()) {
+		return false
+	}
+	if r.class != nil && !r.class.MatchString(stat.Class) {
+		return false
+	}
+	return r.title == nil || r.title.MatchString(stat.Title)
+}
+
+// Match returns the category and tags that the rules assign to a session.
+// Both are empty if no rule matches.
+func (rules *Rules) Match(stat storage.WindowStats) (string, []string) {
+	var category string
+	var tags []string
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if !rule.matches(stat) {
+			continue
+		}
+		if category == "" {
+			category = rule.Category
+		}
+		for _, tag := range rule.Tags {
+			if !contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return category, tags
+}
+
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Categorize returns the session with the category and tags that the rules
+// assign to it.
+func (rules *Rules) Categorize(stat storage.WindowStats) storage.WindowStats {
+	stat.Category, stat.Tags = rules.Match(stat)
+	return stat
+}
+
+// Engine holds the rules from a file and reloads them when it changes.
+type Engine struct {
+	file *rulesfile.File[*Rules]
+}
+
+// Load reads the rules file at path. A missing file means no rules.
+func Load(path string) (*Engine, error) {
+	file, err := rulesfile.Load(path, "category rules", Parse, &Rules{})
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{file: file}, nil
+}
+
+// Reload re-reads the rules file. The current rules stay in force if it
+// cannot be read or parsed.
+func (e *Engine) Reload() error {
+	return e.file.Reload()
+}
+
+// Watch reloads the rules whenever the file's modification time changes,
+// checking every interval, and calls changed after each successful reload.
+// It does not return.
+func (e *Engine) Watch(interval time.Duration, changed func()) {
+	e.file.Watch(interval, changed)
+}
+
+// Match returns the category and tags that the current rules assign to a
+// session.
+func (e *Engine) Match(stat storage.WindowStats) (string, []string) {
+	return e.file.Rules().Match(stat)
+}
+
+// Categorize returns the session with the category and tags that the
+// current rules assign to it.
+func (e *Engine) Categorize(stat storage.WindowStats) storage.WindowStats {
+	stat.Category, stat.Tags = e.Match(stat)
+	return stat
+}
+
+// Reapply updates the categories and tags of the history in db to the
+// current rules, and returns how many sessions changed.
+func (e *Engine) Reapply(db storage.Storage) (int, error) {
+	return db.Recategorize(e.Match)
+}
@@ -0,0 +1,174 @@
+package category
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+const testRules = `{"rules": [
+	{"app": "^code\\.exe$", "category": "Development", "tags": ["editor"]},
+	{"title": "(?i)meeting", "category": "Meetings", "tags": ["calls"], "priority": 10},
+	{"app": "^firefox\\.exe$", "category": "Browsing", "tags": ["web"]},
+	{"title": "github\\.com", "category": "Development", "tags": ["code review"], "priority": 5},
+	{"class": "^Slack$", "category": "Chat"},
+	{"title": "\\.go\\b", "tags": ["go", "editor"]}
+]}`
+
+func TestMatch(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	tests := []struct {
+		name         string
+		stat         storage.WindowStats
+		wantCategory string
+		wantTags     []string
+	}{
+		{
+			name: "no rule matches",
+			stat: storage.WindowStats{Title: "Calculator", Process: "calc.exe"},
+		},
+		{
+			name:         "single rule",
+			stat:         storage.WindowStats{Title: "Inbox", Process: "slack.exe", Class: "Slack"},
+			wantCategory: "Chat",
+		},
+		{
+			name:         "higher priority wins over file order",
+			stat:         storage.WindowStats{Title: "Pull request - github.com", Process: "firefox.exe"},
+			wantCategory: "Development",
+			wantTags:     []string{"code review", "web"},
+		},
+		{
+			name:         "highest priority wins",
+			stat:         storage.WindowStats{Title: "Meeting notes - github.com", Process: "firefox.exe"},
+			wantCategory: "Meetings",
+			wantTags:     []string{"calls", "code review", "web"},
+		},
+		{
+			name:         "tags of every matching rule are merged without duplicates",
+			stat:         storage.WindowStats{Title: "main.go - window monitor", Process: "code.exe"},
+			wantCategory: "Development",
+			wantTags:     []string{"editor", "go"},
+		},
+		{
+			name:     "rules without a category only add tags",
+			stat:     storage.WindowStats{Title: "main.go", Process: "vim"},
+			wantTags: []string{"go", "editor"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category, tags := rules.Match(tt.stat)
+			if category != tt.wantCategory || fmt.Sprint(tags) != fmt.Sprint(tt.wantTags) {
+				t.Errorf("Match = %q %v, want %q %v", category, tags, tt.wantCategory, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{"not JSON", `{"rules": [`},
+		{"no category or tags", `{"rules": [{"app": "x"}]}`},
+		{"invalid app pattern", `{"rules": [{"app": "(", "category": "A"}]}`},
+		{"invalid class pattern", `{"rules": [{"class": "(", "category": "A"}]}`},
+		{"invalid title pattern", `{"rules": [{"title": "[", "category": "A"}]}`},
+	} {
+		if _, err := Parse([]byte(tt.data)); err == nil {
+			t.Errorf("%s: Parse succeeded", tt.name)
+		}
+	}
+}
+
+func TestReapply(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		open func(t *testing.T, dir string) storage.Storage
+	}{
+		{"file", func(t *testing.T, dir string) storage.Storage {
+			db, err := storage.NewFileStorage(filepath.Join(dir, "stats.json"))
+			if err != nil {
+				t.Fatalf("NewFileStorage: %v", err)
+			}
+			return db
+		}},
+		{"sqlite", func(t *testing.T, dir string) storage.Storage {
+			db, err := storage.NewSQLiteStorage(filepath.Join(dir, "stats.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStorage: %v", err)
+			}
+			return db
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := tt.open(t, dir)
+			defer db.Close()
+
+			start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+			for i, stat := range []storage.WindowStats{
+				{Title: "main.go", Process: "code.exe"},
+				{Title: "Weekly meeting", Process: "zoom.exe", Category: "Old", Tags: []string{"old"}},
+				{Title: "Calculator", Process: "calc.exe"},
+				{Title: "Idle", State: storage.StateIdle},
+			} {
+				stat.Start = start.Add(time.Duration(i) * time.Hour)
+				stat.Duration = 30 * time.Minute
+				stat.Date = stat.Start.Add(stat.Duration)
+				if err := db.SaveWindowStats(stat); err != nil {
+					t.Fatalf("SaveWindowStats: %v", err)
+				}
+			}
+
+			path := filepath.Join(dir, "categories.json")
+			if err := os.WriteFile(path, []byte(testRules), 0600); err != nil {
+				t.Fatal(err)
+			}
+			engine, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			n, err := engine.Reapply(db)
+			if err != nil {
+				t.Fatalf("Reapply: %v", err)
+			}
+			// The calculator and the idle span are left alone
+			if n != 2 {
+				t.Errorf("Reapply changed %d sessions, want 2", n)
+			}
+
+			stats, err := db.Sessions(start, start.Add(24*time.Hour))
+			if err != nil {
+				t.Fatalf("Sessions: %v", err)
+			}
+			got := make(map[string]string)
+			for _, stat := range stats {
+				got[stat.Title] = fmt.Sprint(stat.Category, stat.Tags)
+			}
+			want := map[string]string{
+				"main.go":        "Development[editor go]",
+				"Weekly meeting": "Meetings[calls]",
+				"Calculator":     "[]",
+				"Idle":           "[]",
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("categories after Reapply = %v, want %v", got, want)
+			}
+
+			// Nothing changes the second time
+			if n, err := engine.Reapply(db); err != nil || n != 0 {
+				t.Errorf("second Reapply = %d, %v", n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds the user-tunable settings read from config.json in the data
+// directory. Missing fields keep their defaults.
+type Config struct {
+	// IdleThreshold is how long the user may go without keyboard or mouse
+	// input before the current session is closed and counted as idle.
+	// Zero disables idle detection.
+	IdleThreshold Duration `json:"idle_threshold"`
+
+	// GapPolicy is "split", "discard" or "keep"; see monitor.GapPolicy.
+	GapPolicy string `json:"gap_policy"`
+	// MaxGap is the longest pause in sampling that is still credited to
+	// the open window without applying GapPolicy.
+	MaxGap Duration `json:"max_gap"`
+
+	// StorageBackend is "sqlite" or "file" (a JSON-lines log).
+	StorageBackend string `json:"storage_backend"`
+
+	// DayStartHour is the hour (0-23) at which a new day begins for daily
+	// stats and summaries.
+	DayStartHour int `json:"day_start_hour"`
+	// TimeZone is the IANA time zone days are counted in, such as
+	// "Europe/Berlin". Empty means the system time zone.
+	TimeZone string `json:"time_zone"`
+
+	// RawRetentionDays is how many days raw sessions are kept before they
+	// are rolled up into daily totals per application. Zero keeps them.
+	RawRetentionDays int `json:"raw_retention_days"`
+	// MaxRetentionDays is how many days any data is kept. Zero keeps it
+	// forever.
+	MaxRetentionDays int `json:"max_retention_days"`
+
+	// BackupCount is how many rotating backups of the data are kept in
+	// the backups directory. Zero disables backups.
+	BackupCount int `json:"backup_count"`
+	// BackupInterval is how often a backup is taken.
+	BackupInterval Duration `json:"backup_interval"`
+
+	// Encryption is "", "passphrase" or "keyring". The passphrase is read
+	// from the WINDOWMONITOR_PASSPHRASE environment variable. Encryption
+	// needs the file storage backend.
+	Encryption string `json:"encryption"`
+	// Keyring is "system" for the platform credential store or "file" for
+	// a key file in the data directory.
+	Keyring string `json:"keyring"`
+
+	// Productivity rates categories as "productive", "neutral" or
+	// "distracting" for the daily productivity score. Categories that are
+	// not listed are neutral. Empty disables the score.
+	Productivity map[string]string `json:"productivity"`
+}
+
+// Location returns the time zone named by TimeZone.
+func (c *Config) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time_zone %q: %v", c.TimeZone, err)
+	}
+	return loc, nil
+}
+
+// Default returns the configuration used when no config file exists.
+func Default() *Config {
+	return &Config{
+		IdleThreshold:    Duration(5 * time.Minute),
+		GapPolicy:        "split",
+		MaxGap:           Duration(time.Minute),
+		StorageBackend:   "sqlite",
+		RawRetentionDays: 90,
+		BackupCount:      7,
+		BackupInterval:   Duration(24 * time.Hour),
+		Keyring:          "system",
+	}
+}
+
+// Load reads the config file at path on top of the defaults. A missing file
+// is not an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	switch cfg.GapPolicy {
+	case "split", "discard", "keep":
+	default:
+		return nil, fmt.Errorf("invalid gap_policy %q", cfg.GapPolicy)
+	}
+	switch cfg.StorageBackend {
+	case "sqlite", "file":
+	default:
+		return nil, fmt.Errorf("invalid storage_backend %q", cfg.StorageBackend)
+	}
+	if cfg.DayStartHour < 0 || cfg.DayStartHour > 23 {
+		return nil, fmt.Errorf("invalid day_start_hour %d", cfg.DayStartHour)
+	}
+	if _, err := cfg.Location(); err != nil {
+		return nil, err
+	}
+	if cfg.RawRetentionDays < 0 || cfg.MaxRetentionDays < 0 {
+		return nil, fmt.Errorf("retention days must not be negative")
+	}
+	if cfg.MaxRetentionDays > 0 && cfg.MaxRetentionDays < cfg.RawRetentionDays {
+		return nil, fmt.Errorf("max_retention_days must be at least raw_retention_days")
+	}
+	if cfg.BackupCount < 0 {
+		return nil, fmt.Errorf("invalid backup_count %d", cfg.BackupCount)
+	}
+	if cfg.BackupCount > 0 && cfg.BackupInterval <= 0 {
+		return nil, fmt.Errorf("backup_interval must be positive")
+	}
+	switch cfg.Encryption {
+	case "", "passphrase", "keyring":
+	default:
+		return nil, fmt.Errorf("invalid encryption %q", cfg.Encryption)
+	}
+	if cfg.Encryption != "" && cfg.StorageBackend != "file" {
+		return nil, fmt.Errorf("encryption requires storage_backend \"file\"")
+	}
+	switch cfg.Keyring {
+	case "system", "file":
+	default:
+		return nil, fmt.Errorf("invalid keyring %q", cfg.Keyring)
+	}
+	for category, rating := range cfg.Productivity {
+		switch rating {
+		case "productive", "neutral", "distracting":
+		default:
+			return nil, fmt.Errorf("invalid productivity rating %q for %q", rating, category)
+		}
+	}
+	return cfg, nil
+}
+
+// Duration is a time.Duration written as a string such as "5m" or "1h30m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
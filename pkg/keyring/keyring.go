@@ -0,0 +1,104 @@
+// Package keyring keeps secrets, such as the data file key, in the
+// operating system's credential store.
+package keyring
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotFound is returned by Get when no secret has the name.
+var ErrNotFound = errors.New("secret not found")
+
+// Keyring stores named secrets.
+type Keyring interface {
+	Get(name string) ([]byte, error)
+	Set(name string, secret []byte) error
+	Delete(name string) error
+}
+
+// FileKeyring keeps secrets as files in Dir that only the owner can read.
+// It protects them no better than file permissions do and is meant for
+// tests and systems without a credential store.
+type FileKeyring struct {
+	Dir string
+}
+
+func (k FileKeyring) Get(name string) ([]byte, error) {
+	secret, err := os.ReadFile(filepath.Join(k.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %v", err)
+	}
+	return secret, nil
+}
+
+func (k FileKeyring) Set(name string, secret []byte) error {
+	if err := os.MkdirAll(k.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %v", err)
+	}
+	return writeFile(filepath.Join(k.Dir, name), secret)
+}
+
+func (k FileKeyring) Delete(name string) error {
+	if err := os.Remove(filepath.Join(k.Dir, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete secret: %v", err)
+	}
+	return nil
+}
+
+// writeFile replaces path with data through a rename, so a crash never
+// leaves half a secret behind.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secret: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write secret: %v", err)
+	}
+	return nil
+}
+
+// DataKey is the random key that encrypts the data file, held in Keyring
+// under Name and created on first use. It satisfies storage.KeySource.
+type DataKey struct {
+	Keyring Keyring
+	Name    string
+}
+
+func (k DataKey) Method() string {
+	return "keyring"
+}
+
+func (k DataKey) Key(salt []byte) ([]byte, error) {
+	key, err := k.Keyring.Get(k.Name)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if key, err = NewKey(); err != nil {
+		return nil, err
+	}
+	if err := k.Keyring.Set(k.Name, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NewKey returns a random 32-byte key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	return key, nil
+}
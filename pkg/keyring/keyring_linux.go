@@ -0,0 +1,59 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// SecretServiceKeyring stores secrets with the freedesktop Secret Service
+// (GNOME Keyring, KWallet) through secret-tool. Secrets are stored base64
+// encoded, since secret-tool handles text.
+type SecretServiceKeyring struct{}
+
+func (SecretServiceKeyring) Get(name string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "application", "windowmonitor", "name", name)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// secret-tool exits with status 1 and no output for a missing item
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("secret-tool lookup failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(stdout.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret: %v", err)
+	}
+	return secret, nil
+}
+
+func (SecretServiceKeyring) Set(name string, secret []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label", "Window Monitor "+name,
+		"application", "windowmonitor", "name", name)
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(secret))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool store failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (SecretServiceKeyring) Delete(name string) error {
+	cmd := exec.Command("secret-tool", "clear", "application", "windowmonitor", "name", name)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool clear failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// NewDefault returns the Secret Service keyring. dir is unused on Linux.
+func NewDefault(dir string) (Keyring, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, fmt.Errorf("secret-tool not found; install libsecret-tools or use the file keyring")
+	}
+	return SecretServiceKeyring{}, nil
+}
@@ -0,0 +1,72 @@
+package keyring
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// DPAPIKeyring keeps secrets as files in Dir, encrypted with DPAPI so that
+// only the current Windows user can decrypt them.
+type DPAPIKeyring struct {
+	Dir string
+}
+
+func (k DPAPIKeyring) path(name string) string {
+	return filepath.Join(k.Dir, name+".dpapi")
+}
+
+func (k DPAPIKeyring) Get(name string) ([]byte, error) {
+	blob, err := os.ReadFile(k.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %v", err)
+	}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(newBlob(blob), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, fmt.Errorf("CryptUnprotectData failed: %v", err)
+	}
+	return takeBlob(&out), nil
+}
+
+func (k DPAPIKeyring) Set(name string, secret []byte) error {
+	if err := os.MkdirAll(k.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %v", err)
+	}
+	description, _ := windows.UTF16PtrFromString("Window Monitor " + name)
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(newBlob(secret), description, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return fmt.Errorf("CryptProtectData failed: %v", err)
+	}
+	return writeFile(k.path(name), takeBlob(&out))
+}
+
+func (k DPAPIKeyring) Delete(name string) error {
+	if err := os.Remove(k.path(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete secret: %v", err)
+	}
+	return nil
+}
+
+func newBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+// takeBlob copies a blob allocated by DPAPI and frees it.
+func takeBlob(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	return append([]byte(nil), unsafe.Slice(blob.Data, blob.Size)...)
+}
+
+// NewDefault returns a DPAPI keyring that keeps its files in dir.
+func NewDefault(dir string) (Keyring, error) {
+	return DPAPIKeyring{Dir: dir}, nil
+}
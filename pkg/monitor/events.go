@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// EventType says what an Event reports.
+type EventType string
+
+const (
+	// EventStatus reports that the user switched windows, went idle or
+	// away, or came back.
+	EventStatus EventType = "status"
+	// EventSession reports that a session or span was saved.
+	EventSession EventType = "session"
+)
+
+// Event is published to subscribers when the monitor's view of the user
+// changes. Titles have passed the title filter, as they are stored.
+type Event struct {
+	Type EventType
+	// Status is set for EventStatus.
+	Status Status
+	// Session is the saved record for EventSession.
+	Session storage.WindowStats
+}
+
+// Status describes what the user is doing now.
+type Status struct {
+	// State is storage.StateActive while a window has focus, and
+	// otherwise idle, locked or asleep. It is also StateActive, with no
+	// window, when nothing is being tracked.
+	State string
+	// Window is the focused window with its category. Only Title,
+	// Process, PID, Class, Category and Tags are set.
+	Window storage.WindowStats
+	// Hidden is set when the title filter drops the focused window, which
+	// is then left out.
+	Hidden bool
+	// Since is when the window got focus or the state began.
+	Since time.Time
+}
+
+// subscriberBuffer is how many events a subscriber can fall behind before
+// further events are dropped for it.
+const subscriberBuffer = 16
+
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// Subscribe returns a channel of events and a function that ends the
+// subscription and closes the channel. Events are dropped rather than
+// block the monitor if the channel is not drained.
+func (w *WindowMonitor) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	w.subs.mu.Lock()
+	if w.subs.subs == nil {
+		w.subs.subs = make(map[chan Event]struct{})
+	}
+	w.subs.subs[ch] = struct{}{}
+	w.subs.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			w.subs.mu.Lock()
+			delete(w.subs.subs, ch)
+			w.subs.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (w *WindowMonitor) publish(ev Event) {
+	w.subs.mu.Lock()
+	defer w.subs.mu.Unlock()
+	for ch := range w.subs.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Status returns what the user is doing now.
+func (w *WindowMonitor) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// RefreshStatus publishes the status again after passing the focused window
+// through the title filter and categorizer, for when their rules change.
+func (w *WindowMonitor) RefreshStatus() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// A status that cannot match forces the next update to publish
+	w.status = Status{}
+	w.rawStatus = Window{}
+	w.updateStatus()
+}
+
+// updateStatus publishes the current status if it changed since it was
+// last published. It is called after anything that can change it.
+func (w *WindowMonitor) updateStatus() {
+	status := Status{State: storage.StateActive}
+	switch {
+	case w.pausedState != "":
+		status.State = w.pausedState
+		status.Since = w.pausedSince
+	case !w.idleSince.IsZero():
+		status.State = storage.StateIdle
+		status.Since = w.idleSince
+	case w.lastWindow.Title != "":
+		status.Window = storage.WindowStats{
+			Title:   w.lastWindow.Title,
+			Process: w.lastWindow.Process,
+			PID:     w.lastWindow.PID,
+			Class:   w.lastWindow.Class,
+		}
+		status.Since = w.lastTime
+	}
+
+	// Only compare the raw window, as the filter and categorizer can be
+	// costly; RefreshStatus runs them again when their rules change
+	if status.State == w.status.State && sameWindow(Window{
+		Title:   status.Window.Title,
+		Process: status.Window.Process,
+		PID:     status.Window.PID,
+	}, w.rawStatus) {
+		return
+	}
+	w.rawStatus = Window{
+		Title:   status.Window.Title,
+		Process: status.Window.Process,
+		PID:     status.Window.PID,
+	}
+
+	if status.Window.Title != "" {
+		if w.filter != nil {
+			var ok bool
+			if status.Window, ok = w.filter.Apply(status.Window); !ok {
+				status.Window = storage.WindowStats{}
+				status.Hidden = true
+			}
+		}
+		if w.category != nil && !status.Hidden {
+			status.Window = w.category.Categorize(status.Window)
+		}
+	}
+	status.Since = status.Since.Round(0)
+	w.status = status
+	w.publish(Event{Type: EventStatus, Status: status})
+}
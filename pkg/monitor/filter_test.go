@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/privacy"
+)
+
+// recordingNotifier keeps the titles it is asked to announce.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	titles []string
+}
+
+func (n *recordingNotifier) ShowWindowSwitchNotification(title string, duration time.Duration) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.titles = append(n.titles, title)
+	return nil
+}
+
+func loadPolicy(t *testing.T, path, rules string) *privacy.Policy {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := privacy.Load(path)
+	if err != nil {
+		t.Fatalf("privacy.Load: %v", err)
+	}
+	return policy
+}
+
+func TestFilteredTitlesAreNotSavedOrShown(t *testing.T) {
+	policy := loadPolicy(t, filepath.Join(t.TempDir(), "privacy.json"), `{"rules": [
+		{"title": "Secret", "action": "drop"},
+		{"action": "redact", "pattern": "[\\w.]+@[\\w.]+", "replacement": "<email>"}
+	]}`)
+	source := NewScriptedSource(scriptStart,
+		ScriptStep{Window: win("Secret plan"), Duration: time.Second},
+		ScriptStep{Window: win("Mail to a.b@example.com"), Duration: time.Second},
+		ScriptStep{Window: win("Editor"), Duration: time.Hour},
+	)
+	db := &recordingStorage{}
+	notifier := &recordingNotifier{}
+	m := NewWindowMonitor(db, source, notifier)
+	m.SetClock(source)
+	m.SetTitleFilter(policy)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	var hidden bool
+	for i := 0; i < 3; i++ {
+		m.observe(source.ActiveWindow())
+		if i == 0 {
+			status := m.Status()
+			hidden = status.Hidden && status.Window.Title == ""
+		}
+		source.Sleep(time.Second)
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !hidden {
+		t.Error("the status of a dropped window is not hidden")
+	}
+
+	checkRecords(t, db.records(scriptStart), []record{
+		{Title: "Mail to <email>", Start: time.Second, End: 2 * time.Second},
+		{Title: "Editor", Start: 2 * time.Second, End: 3 * time.Second},
+	})
+	var shown []string
+	shown = append(shown, notifier.titles...)
+	unsubscribe()
+	for ev := range events {
+		shown = append(shown, ev.Status.Window.Title, ev.Session.Title)
+	}
+	for _, title := range shown {
+		if strings.Contains(title, "Secret") || strings.Contains(title, "example.com") {
+			t.Errorf("private title %q was announced", title)
+		}
+	}
+}
+
+func TestRefreshStatusAppliesNewRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "privacy.json")
+	policy := loadPolicy(t, path, `{"rules": []}`)
+	source := NewScriptedSource(scriptStart, ScriptStep{Window: win("Mail to a.b@example.com"), Duration: time.Hour})
+	m := NewWindowMonitor(&recordingStorage{}, source, nil)
+	m.SetClock(source)
+	m.SetTitleFilter(policy)
+
+	m.observe(source.ActiveWindow())
+	if got := m.Status().Window.Title; got != "Mail to a.b@example.com" {
+		t.Fatalf("status title %q before the rules change", got)
+	}
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	if err := os.WriteFile(path, []byte(`{"rules": [{"title": "@", "action": "drop"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	m.RefreshStatus()
+	status := m.Status()
+	if !status.Hidden || status.Window.Title != "" {
+		t.Errorf("status after the refresh = %+v, want it hidden", status)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventStatus || !ev.Status.Hidden {
+			t.Errorf("published %+v, want the hidden status", ev)
+		}
+	default:
+		t.Error("the refreshed status was not published")
+	}
+}
@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+func TestGapPolicy(t *testing.T) {
+	// Editor is sampled for 2s, then the samples stop, either for longer
+	// than maxGap or across a wall clock jump, and resume for 1s
+	sleep := func(s *ScriptedSource) { s.Sleep(2 * time.Minute) }
+	jump := func(s *ScriptedSource) { s.Jump(2 * time.Minute) }
+	tests := []struct {
+		name   string
+		policy GapPolicy
+		maxGap time.Duration
+		gap    func(s *ScriptedSource)
+		want   []record
+	}{
+		{
+			name:   "split after maxGap",
+			policy: GapSplit,
+			maxGap: time.Minute,
+			gap:    sleep,
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Gap", State: storage.StateGap, Start: 2 * time.Second, End: 122 * time.Second},
+				{Title: "Editor", Start: 122 * time.Second, End: 123 * time.Second},
+			},
+		},
+		{
+			name:   "discard after maxGap",
+			policy: GapDiscard,
+			maxGap: time.Minute,
+			gap:    sleep,
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Editor", Start: 122 * time.Second, End: 123 * time.Second},
+			},
+		},
+		{
+			name:   "keep after maxGap",
+			policy: GapKeep,
+			maxGap: time.Minute,
+			gap:    sleep,
+			want: []record{
+				{Title: "Editor", Start: 0, End: 123 * time.Second, Interrupted: true},
+			},
+		},
+		{
+			name:   "pause within maxGap",
+			policy: GapSplit,
+			maxGap: time.Hour,
+			gap:    sleep,
+			want: []record{
+				{Title: "Editor", Start: 0, End: 123 * time.Second},
+			},
+		},
+		{
+			name:   "split at a clock jump within maxGap",
+			policy: GapSplit,
+			maxGap: time.Hour,
+			gap:    jump,
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Gap", State: storage.StateGap, Start: 2 * time.Second, End: 122 * time.Second},
+				{Title: "Editor", Start: 122 * time.Second, End: 123 * time.Second},
+			},
+		},
+		{
+			name:   "discard at a clock jump within maxGap",
+			policy: GapDiscard,
+			maxGap: time.Hour,
+			gap:    jump,
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Editor", Start: 122 * time.Second, End: 123 * time.Second},
+			},
+		},
+		{
+			name:   "keep at a clock jump within maxGap",
+			policy: GapKeep,
+			maxGap: time.Hour,
+			gap:    jump,
+			want: []record{
+				{Title: "Editor", Start: 0, End: 123 * time.Second, Interrupted: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewScriptedSource(scriptStart, ScriptStep{Window: win("Editor"), Duration: time.Hour})
+			db := &recordingStorage{}
+			m := NewWindowMonitor(db, source, nil)
+			m.SetClock(source)
+			m.SetGapPolicy(tt.policy, tt.maxGap)
+
+			for i := 0; i < 2; i++ {
+				m.observe(source.ActiveWindow())
+				source.Sleep(time.Second)
+			}
+			m.observe(source.ActiveWindow())
+			tt.gap(source)
+			m.observe(source.ActiveWindow())
+			source.Sleep(time.Second)
+			if err := m.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+			checkRecords(t, db.records(scriptStart), tt.want)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/windowmonitor/pkg/x11"
+)
+
+// X11IdleDetector asks the X server's MIT-SCREEN-SAVER extension how long
+// ago the last input event happened.
+type X11IdleDetector struct {
+	conn *x11.Conn
+}
+
+// NewX11IdleDetector connects to display, or $DISPLAY if empty.
+func NewX11IdleDetector(display string) (*X11IdleDetector, error) {
+	conn, err := x11.Dial(display)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ScreenSaverIdle(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &X11IdleDetector{conn: conn}, nil
+}
+
+func (d *X11IdleDetector) Close() error {
+	return d.conn.Close()
+}
+
+func (d *X11IdleDetector) IdleTime() (time.Duration, error) {
+	return d.conn.ScreenSaverIdle()
+}
+
+// ScreenSaverIdleDetector calls GetSessionIdleTime on the session bus
+// org.freedesktop.ScreenSaver service, which works under Wayland
+// compositors that implement it.
+type ScreenSaverIdleDetector struct{}
+
+func (ScreenSaverIdleDetector) IdleTime() (time.Duration, error) {
+	out, err := exec.Command("dbus-send", "--session", "--print-reply=literal",
+		"--dest=org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver",
+		"org.freedesktop.ScreenSaver.GetSessionIdleTime").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query screensaver idle time: %v", err)
+	}
+	// The literal reply looks like "   uint32 12345"
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty screensaver reply")
+	}
+	ms, err := strconv.ParseUint(fields[len(fields)-1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected screensaver reply %q", out)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// NewDefaultIdleDetector returns the idle detector for this platform:
+// MIT-SCREEN-SAVER under X11, org.freedesktop.ScreenSaver otherwise.
+func NewDefaultIdleDetector() (IdleDetector, error) {
+	if os.Getenv("DISPLAY") != "" && os.Getenv("SWAYSOCK") == "" {
+		if d, err := NewX11IdleDetector(""); err == nil {
+			return d, nil
+		}
+	}
+	if _, err := (ScreenSaverIdleDetector{}).IdleTime(); err != nil {
+		return nil, err
+	}
+	return ScreenSaverIdleDetector{}, nil
+}
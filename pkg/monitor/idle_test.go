@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+func TestIdleBoundaries(t *testing.T) {
+	const threshold = 5 * time.Second
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		steps     []ScriptStep
+		want      []record
+	}{
+		{
+			name:      "idle shorter than the threshold is not split out",
+			threshold: threshold,
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 10 * time.Second},
+				{Window: win("Editor"), Duration: 4 * time.Second, Idle: true},
+				{Window: win("Editor"), Duration: 2 * time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 16 * time.Second},
+			},
+		},
+		{
+			name:      "idle past the threshold ends the session at the last input",
+			threshold: threshold,
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 10 * time.Second},
+				{Window: win("Editor"), Duration: 20 * time.Second, Idle: true},
+				{Window: win("Browser"), Duration: 5 * time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 10 * time.Second},
+				{Title: "Idle", State: storage.StateIdle, Start: 10 * time.Second, End: 30 * time.Second},
+				{Title: "Browser", Start: 30 * time.Second, End: 35 * time.Second},
+			},
+		},
+		{
+			name:      "resuming in the same window starts a new session",
+			threshold: threshold,
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 10 * time.Second},
+				{Window: win("Editor"), Duration: 20 * time.Second, Idle: true},
+				{Window: win("Editor"), Duration: 5 * time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 10 * time.Second},
+				{Title: "Idle", State: storage.StateIdle, Start: 10 * time.Second, End: 30 * time.Second},
+				{Title: "Editor", Start: 30 * time.Second, End: 35 * time.Second},
+			},
+		},
+		{
+			name:      "window changes while idle are not counted",
+			threshold: threshold,
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 10 * time.Second},
+				{Window: win("Editor"), Duration: 8 * time.Second, Idle: true},
+				{Window: win("Popup"), Duration: 12 * time.Second, Idle: true},
+				{Window: win("Editor"), Duration: 5 * time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 10 * time.Second},
+				{Title: "Idle", State: storage.StateIdle, Start: 10 * time.Second, End: 30 * time.Second},
+				{Title: "Editor", Start: 30 * time.Second, End: 35 * time.Second},
+			},
+		},
+		{
+			name:      "idle span does not overlap a session that began during it",
+			threshold: threshold,
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 3 * time.Second, Idle: true},
+				{Window: win("Popup"), Duration: 10 * time.Second, Idle: true},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 3 * time.Second},
+				{Title: "Idle", State: storage.StateIdle, Start: 3 * time.Second, End: 13 * time.Second},
+			},
+		},
+		{
+			name:      "idle span open at stop is recorded",
+			threshold: threshold,
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 10 * time.Second},
+				{Window: win("Editor"), Duration: 20 * time.Second, Idle: true},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 10 * time.Second},
+				{Title: "Idle", State: storage.StateIdle, Start: 10 * time.Second, End: 30 * time.Second},
+			},
+		},
+		{
+			name: "without a detector idle time counts",
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 10 * time.Second},
+				{Window: win("Editor"), Duration: 20 * time.Second, Idle: true},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 30 * time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRecords(t, runScript(t, tt.threshold, tt.steps...), tt.want)
+		})
+	}
+}
+
+// failingIdle is an idle detector that cannot read the idle time.
+type failingIdle struct{}
+
+func (failingIdle) IdleTime() (time.Duration, error) {
+	return 0, errors.New("no idle time")
+}
+
+func TestIdleDetectorErrors(t *testing.T) {
+	source := NewScriptedSource(scriptStart,
+		ScriptStep{Window: win("Editor"), Duration: 10 * time.Second, Idle: true},
+	)
+	db := &recordingStorage{}
+	m := NewWindowMonitor(db, source, nil)
+	m.SetClock(source)
+	m.SetIdleDetector(failingIdle{}, time.Second)
+	m.Start()
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	// Tracking carries on as if idle detection were off
+	checkRecords(t, db.records(scriptStart), []record{
+		{Title: "Editor", Start: 0, End: 10 * time.Second},
+	})
+}
+
+func TestScriptedIdleTime(t *testing.T) {
+	source := NewScriptedSource(scriptStart,
+		ScriptStep{Window: win("Editor"), Duration: 10 * time.Second},
+		ScriptStep{Window: win("Editor"), Duration: 5 * time.Second, Idle: true},
+		ScriptStep{Window: win("Popup"), Duration: 5 * time.Second, Idle: true},
+		ScriptStep{Window: win("Editor"), Duration: 5 * time.Second},
+	)
+	for _, tt := range []struct {
+		at, want time.Duration
+	}{
+		{0, 0},
+		{9 * time.Second, 0},
+		{10 * time.Second, 0},
+		{12 * time.Second, 2 * time.Second},
+		{17 * time.Second, 7 * time.Second},
+		{20 * time.Second, 0},
+	} {
+		source.now = scriptStart.Add(tt.at)
+		if got, err := source.IdleTime(); err != nil || got != tt.want {
+			t.Errorf("IdleTime at %v = %v, %v, want %v", tt.at, got, err, tt.want)
+		}
+	}
+}
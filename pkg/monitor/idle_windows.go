@@ -0,0 +1,39 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	getLastInputInfo = user32.NewProc("GetLastInputInfo")
+	getTickCount     = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetTickCount")
+)
+
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// Win32IdleDetector reads the time since the last input event through
+// GetLastInputInfo.
+type Win32IdleDetector struct{}
+
+func (Win32IdleDetector) IdleTime() (time.Duration, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	ret, _, _ := getLastInputInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo failed")
+	}
+	now, _, _ := getTickCount.Call()
+	// Both tick counts wrap after ~49 days; unsigned subtraction handles it
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond, nil
+}
+
+// NewDefaultIdleDetector returns the idle detector for this platform.
+func NewDefaultIdleDetector() (IdleDetector, error) {
+	return Win32IdleDetector{}, nil
+}
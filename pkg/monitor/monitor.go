@@ -1,75 +1,537 @@
 package monitor
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"syscall"
+	"sync"
 	"time"
-	"unsafe"
 
-	"github.com/windowmonitor/pkg/notification"
 	"github.com/windowmonitor/pkg/storage"
-	"golang.org/x/sys/windows"
 )
 
-type WindowMonitor struct {
-	db *storage.Storage
-	notifier *notification.WindowsNotifier
-	lastWindow string
-	lastTime time.Time
-}
+// PollInterval is how often Start samples the window source.
+const PollInterval = 100 * time.Millisecond
+
+// idleCheckInterval limits how often the idle detector is queried; some
+// detectors shell out. Event-driven monitoring also uses it as a heartbeat
+// for gap detection.
+const idleCheckInterval = time.Second
+
+// clockJumpTolerance is how far wall and monotonic time may drift apart
+// between two samples before it is treated as a clock change or suspend.
+const clockJumpTolerance = 2 * time.Second
+
+// GapPolicy decides what happens to the open session when the monitor
+// notices a gap in its own sampling, e.g. after an unannounced suspend or a
+// wall clock change.
+type GapPolicy string
 
-var (
-	user32                = windows.NewLazyDLL("user32.dll")
-	getForegroundWindow   = user32.NewProc("GetForegroundWindow")
-	getWindowTextW        = user32.NewProc("GetWindowTextW")
+const (
+	// GapSplit credits the window up to the last sample and records the
+	// gap as a separate span.
+	GapSplit GapPolicy = "split"
+	// GapDiscard credits the window up to the last sample and drops the gap.
+	GapDiscard GapPolicy = "discard"
+	// GapKeep credits the whole gap to the window but marks the session as
+	// interrupted.
+	GapKeep GapPolicy = "keep"
 )
 
-func NewWindowMonitor(db *storage.Storage) *WindowMonitor {
-	notifier := notification.NewWindowsNotifier(db)
+// Notifier is told how long the previous window was in the foreground
+// whenever the focus changes.
+type Notifier interface {
+	ShowWindowSwitchNotification(windowTitle string, duration time.Duration) error
+}
+
+// TitleFilter rewrites or drops a session before it is stored or shown,
+// so that private window titles never leave the monitor. ok is false if
+// the session must be dropped.
+type TitleFilter interface {
+	Apply(stat storage.WindowStats) (filtered storage.WindowStats, ok bool)
+}
+
+// Categorizer assigns a category and tags to a window session before it is
+// stored.
+type Categorizer interface {
+	Categorize(stat storage.WindowStats) storage.WindowStats
+}
+
+// spanTitles names the records written for time that is not spent in a
+// window.
+var spanTitles = map[string]string{
+	storage.StateIdle:   "Idle",
+	storage.StateLocked: "Locked",
+	storage.StateAsleep: "Asleep",
+	storage.StateGap:    "Gap",
+}
+
+type WindowMonitor struct {
+	db       storage.Storage
+	source   WindowSource
+	notifier Notifier
+	clock    Clock
+	sessions SessionWatcher
+	filter   TitleFilter
+	category Categorizer
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// mu guards the session state below, which is touched by the sampling
+	// loop, session events and Stop/Flush.
+	mu          sync.Mutex
+	started     bool
+	stopped     bool
+	lastWindow  Window
+	lastTime    time.Time
+	locked      bool
+	pausedState string
+	pausedSince time.Time
+
+	idle          IdleDetector
+	idleThreshold time.Duration
+	idleSince     time.Time
+	lastIdleCheck time.Time
+
+	gapPolicy   GapPolicy
+	maxGap      time.Duration
+	lastSeen    time.Time
+	interrupted bool
+
+	// status is what was last published, and rawStatus the window it was
+	// derived from before filtering
+	status    Status
+	rawStatus Window
+	subs      subscribers
+}
+
+// NewWindowMonitor creates a monitor that samples source and records the
+// resulting sessions in db. notifier may be nil.
+func NewWindowMonitor(db storage.Storage, source WindowSource, notifier Notifier) *WindowMonitor {
 	return &WindowMonitor{
-		db: db,
-		notifier: notifier,
-		lastTime: time.Now(),
+		db:        db,
+		source:    source,
+		notifier:  notifier,
+		clock:     realClock{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		lastTime:  time.Now(),
+		gapPolicy: GapSplit,
+		maxGap:    time.Minute,
 	}
 }
 
-func (w *WindowMonitor) getActiveWindowTitle() (string, error) {
-	hwnd, _, _ := getForegroundWindow.Call()
-	if hwnd == 0 {
-		return "", fmt.Errorf("no active window")
-	}
+// SetClock replaces the clock used to pace the polling loop.
+func (w *WindowMonitor) SetClock(clock Clock) {
+	w.clock = clock
+}
+
+// SetIdleDetector enables idle detection: once the user has been idle for
+// threshold the open session is closed at the time of the last input and
+// the idle span is recorded separately when input resumes.
+func (w *WindowMonitor) SetIdleDetector(idle IdleDetector, threshold time.Duration) {
+	w.idle = idle
+	w.idleThreshold = threshold
+}
 
-	buf := make([]uint16, 256)
-	_, _, _ = getWindowTextW.Call(
-		hwnd,
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(len(buf)),
-	)
+// SetGapPolicy sets how gaps longer than maxGap between two samples, or wall
+// clock jumps, are accounted.
+func (w *WindowMonitor) SetGapPolicy(policy GapPolicy, maxGap time.Duration) {
+	w.gapPolicy = policy
+	w.maxGap = maxGap
+}
+
+// SetSessionWatcher makes the monitor close the open session when the
+// session is locked or the system suspends, and record those gaps as
+// locked or asleep instead of crediting them to the last window.
+func (w *WindowMonitor) SetSessionWatcher(sessions SessionWatcher) {
+	w.sessions = sessions
+}
+
+// SetTitleFilter makes every window session pass through filter before it
+// is saved or announced.
+func (w *WindowMonitor) SetTitleFilter(filter TitleFilter) {
+	w.filter = filter
+}
 
-	return syscall.UTF16ToString(buf), nil
+// SetCategorizer makes every window session pass through categorizer
+// before it is saved. It sees titles after the title filter.
+func (w *WindowMonitor) SetCategorizer(categorizer Categorizer) {
+	w.category = categorizer
 }
 
+// Start records sessions until the source is closed or Stop is called.
+// Sources that implement EventSource are followed through their event
+// channel; if that is unavailable the source is polled every PollInterval
+// instead.
 func (w *WindowMonitor) Start() {
+	w.mu.Lock()
+	w.started = true
+	w.mu.Unlock()
+	defer close(w.done)
+
+	if w.sessions != nil {
+		events, err := w.sessions.SessionEvents()
+		if err != nil {
+			fmt.Printf("Session events unavailable: %v\n", err)
+		} else {
+			go w.followSession(events)
+		}
+	}
+
+	if es, ok := w.source.(EventSource); ok {
+		events, err := es.Events()
+		if err == nil {
+			w.watch(events)
+			return
+		}
+		fmt.Printf("Window events unavailable, polling instead: %v\n", err)
+	}
+	w.poll()
+}
+
+// Stop ends Start and records the open session, idle or paused span up to
+// now. It waits for Start to return until ctx is done.
+func (w *WindowMonitor) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+
+	w.mu.Lock()
+	started := w.started
+	w.mu.Unlock()
+	if started {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stopped {
+		w.closeOpen(w.clock.Now())
+		w.stopped = true
+		w.updateStatus()
+	}
+	return nil
+}
+
+// Flush records the open session up to now without ending it, so a crash
+// afterwards loses at most the time since the flush.
+func (w *WindowMonitor) Flush(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped || w.lastWindow.Title == "" {
+		return nil
+	}
+	now := w.clock.Now()
+	w.endSession(now)
+	w.lastTime = now
+	return nil
+}
+
+// poll samples the window source until it returns ErrSourceClosed.
+func (w *WindowMonitor) poll() {
 	for {
-		title, err := w.getActiveWindowTitle()
-		if err == nil && title != "" {
-			if title != w.lastWindow && w.lastWindow != "" {
-				duration := time.Since(w.lastTime)
-				if err := w.db.SaveWindowStats(w.lastWindow, duration); err != nil {
-					fmt.Printf("Error saving window stats: %v\n", err)
-				}
-				
-				// Show notification about the time spent on the previous window
-				if err := w.notifier.ShowWindowSwitchNotification(w.lastWindow, duration); err != nil {
-					fmt.Printf("Error showing notification: %v\n", err)
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		win, err := w.source.ActiveWindow()
+		if errors.Is(err, ErrSourceClosed) {
+			return
+		}
+		w.observe(win, err)
+		w.clock.Sleep(PollInterval)
+	}
+}
+
+// watch consumes pushed window changes until the channel is closed.
+func (w *WindowMonitor) watch(events <-chan Window) {
+	// Events only arrive on changes, so a heartbeat drives idle and gap
+	// detection
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case win, ok := <-events:
+			if !ok {
+				return
+			}
+			w.observe(win, nil)
+		case <-ticker.C:
+			w.mu.Lock()
+			now := w.clock.Now()
+			w.checkGap(now)
+			wasIdle := !w.idleSince.IsZero()
+			if !w.checkIdle(now) && wasIdle {
+				// No focus event marks the return from idle, so resample
+				w.observeLocked(w.source.ActiveWindow())
+			}
+			w.updateStatus()
+			w.mu.Unlock()
+		}
+	}
+}
+
+// followSession applies lock and suspend events until the channel closes.
+func (w *WindowMonitor) followSession(events <-chan SessionEvent) {
+	for ev := range events {
+		w.mu.Lock()
+		if !w.stopped {
+			w.handleSessionEvent(ev, w.clock.Now())
+			w.updateStatus()
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (w *WindowMonitor) handleSessionEvent(ev SessionEvent, now time.Time) {
+	switch ev {
+	case SessionLocked:
+		w.locked = true
+		if w.pausedState != storage.StateAsleep {
+			w.pause(now, storage.StateLocked)
+		}
+	case SystemSuspending:
+		w.pause(now, storage.StateAsleep)
+	case SessionUnlocked:
+		w.locked = false
+		w.resume(now)
+	case SystemResumed:
+		// Most systems come back to the lock screen
+		if w.locked {
+			w.pause(now, storage.StateLocked)
+		} else {
+			w.resume(now)
+		}
+	}
+}
+
+// pause closes whatever is open and starts a span in state.
+func (w *WindowMonitor) pause(now time.Time, state string) {
+	if w.pausedState == state {
+		return
+	}
+	w.closeOpen(now)
+	w.pausedState = state
+	w.pausedSince = now
+}
+
+// resume ends a paused span and picks up the current window.
+func (w *WindowMonitor) resume(now time.Time) {
+	if w.pausedState == "" {
+		return
+	}
+	w.closeOpen(now)
+	w.observeLocked(w.source.ActiveWindow())
+}
+
+// closeOpen records the open window session, idle span or paused span up
+// to now.
+func (w *WindowMonitor) closeOpen(now time.Time) {
+	if w.pausedState != "" {
+		w.saveSpan(w.pausedState, w.pausedSince, now)
+		w.pausedState = ""
+		w.pausedSince = time.Time{}
+	}
+	if !w.idleSince.IsZero() {
+		w.saveSpan(storage.StateIdle, w.idleSince, now)
+		w.idleSince = time.Time{}
+	}
+	if w.lastWindow.Title != "" {
+		w.endSession(now)
+		w.lastWindow = Window{}
+	}
+}
+
+// observe updates the open session with a sample of the foreground window.
+// Polled and pushed samples both go through here so they produce identical
+// session records.
+func (w *WindowMonitor) observe(win Window, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.observeLocked(win, err)
+}
+
+func (w *WindowMonitor) observeLocked(win Window, err error) {
+	defer w.updateStatus()
+	if w.stopped || w.pausedState != "" {
+		return
+	}
+	now := w.clock.Now()
+	w.checkGap(now)
+	if w.checkIdle(now) {
+		return
+	}
+	if err != nil || win.Title == "" {
+		return
+	}
+	if w.lastWindow.Title != "" && !sameWindow(win, w.lastWindow) {
+		w.endSession(win.Time)
+		w.lastTime = win.Time
+	} else if w.lastWindow.Title == "" {
+		w.lastTime = win.Time
+	}
+	w.lastWindow = win
+}
+
+// endSession records the time from lastTime to end against the last window.
+func (w *WindowMonitor) endSession(end time.Time) {
+	duration := wallSince(w.lastTime, end)
+	interrupted := w.interrupted
+	w.interrupted = false
+	if duration <= 0 {
+		return
+	}
+	stat := storage.WindowStats{
+		Title:       w.lastWindow.Title,
+		Process:     w.lastWindow.Process,
+		PID:         w.lastWindow.PID,
+		Class:       w.lastWindow.Class,
+		Duration:    duration,
+		Start:       w.lastTime.Round(0),
+		Date:        end.Round(0),
+		Interrupted: interrupted,
+	}
+	if w.filter != nil {
+		var ok bool
+		if stat, ok = w.filter.Apply(stat); !ok {
+			return
+		}
+	}
+	if w.category != nil {
+		stat = w.category.Categorize(stat)
+	}
+	if err := w.db.SaveWindowStats(stat); err != nil {
+		fmt.Printf("Error saving window stats: %v\n", err)
+	} else {
+		w.publish(Event{Type: EventSession, Session: stat})
+	}
+
+	// Show notification about the time spent on the previous window
+	if w.notifier != nil {
+		if err := w.notifier.ShowWindowSwitchNotification(stat.Title, duration); err != nil {
+			fmt.Printf("Error showing notification: %v\n", err)
+		}
+	}
+}
+
+// checkIdle closes the open session when the user goes idle and records
+// the idle span once input resumes. It reports whether the user is idle.
+func (w *WindowMonitor) checkIdle(now time.Time) bool {
+	if w.idle == nil || w.idleThreshold <= 0 {
+		return false
+	}
+	if now.Sub(w.lastIdleCheck) < idleCheckInterval {
+		return !w.idleSince.IsZero()
+	}
+	w.lastIdleCheck = now
+
+	idle, err := w.idle.IdleTime()
+	if err != nil {
+		fmt.Printf("Error reading idle time: %v\n", err)
+		return !w.idleSince.IsZero()
+	}
+
+	if idle >= w.idleThreshold {
+		if w.idleSince.IsZero() {
+			w.idleSince = now.Add(-idle)
+			if w.lastWindow.Title != "" {
+				if w.idleSince.Before(w.lastTime) {
+					w.idleSince = w.lastTime
 				}
-				
-				w.lastTime = time.Now()
-			} else if w.lastWindow == "" {
-				w.lastTime = time.Now()
+				w.endSession(w.idleSince)
+				w.lastWindow = Window{}
 			}
-			w.lastWindow = title
 		}
-		time.Sleep(100 * time.Millisecond)
+		return true
+	}
+
+	if !w.idleSince.IsZero() {
+		w.saveSpan(storage.StateIdle, w.idleSince, now)
+		w.idleSince = time.Time{}
+	}
+	return false
+}
+
+// checkGap looks for a hole in sampling since the previous call: either
+// more than maxGap of wall time, or wall and monotonic time disagreeing,
+// which happens when the system suspends (the monotonic clock stops) or
+// the wall clock is changed. The open session is then handled according
+// to the gap policy.
+func (w *WindowMonitor) checkGap(now time.Time) {
+	last := w.lastSeen
+	w.lastSeen = now
+	if last.IsZero() || w.lastWindow.Title == "" {
+		return
 	}
-}
\ No newline at end of file
+
+	wall := wallSince(last, now)
+	elapsed := now.Sub(last)
+	if c, ok := w.clock.(MonotonicClock); ok {
+		elapsed = c.Elapsed(last, now)
+	}
+	jump := wall - elapsed
+	if jump < 0 {
+		jump = -jump
+	}
+	if wall <= w.maxGap && jump < clockJumpTolerance {
+		return
+	}
+
+	switch w.gapPolicy {
+	case GapKeep:
+		w.interrupted = true
+	case GapDiscard:
+		w.endSession(last)
+		w.lastTime = now
+	default:
+		w.endSession(last)
+		w.saveSpan(storage.StateGap, last, now)
+		w.lastTime = now
+	}
+}
+
+// wallSince returns the wall clock time between start and end. Monotonic
+// readings are stripped on purpose: the monotonic clock does not advance
+// during suspend, and recorded durations should match the calendar.
+func wallSince(start, end time.Time) time.Duration {
+	return end.Round(0).Sub(start.Round(0))
+}
+
+// saveSpan records the time from start to end spent away from any window.
+func (w *WindowMonitor) saveSpan(state string, start, end time.Time) {
+	if !end.After(start) {
+		return
+	}
+	stat := storage.WindowStats{
+		Title:    spanTitles[state],
+		Duration: wallSince(start, end),
+		Start:    start.Round(0),
+		Date:     end.Round(0),
+		State:    state,
+	}
+	if err := w.db.SaveWindowStats(stat); err != nil {
+		fmt.Printf("Error saving %s span: %v\n", state, err)
+		return
+	}
+	w.publish(Event{Type: EventSession, Session: stat})
+}
+
+// sameWindow reports whether two snapshots belong to the same session. The
+// handle is ignored so that reopening a window does not split a session.
+func sameWindow(a, b Window) bool {
+	return a.Title == b.Title && a.Process == b.Process && a.PID == b.PID
+}
@@ -0,0 +1,259 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// recordingStorage keeps saved sessions in memory. Only SaveWindowStats is
+// implemented.
+type recordingStorage struct {
+	storage.Storage
+	mu    sync.Mutex
+	saved []storage.WindowStats
+}
+
+func (r *recordingStorage) SaveWindowStats(stat storage.WindowStats) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = append(r.saved, stat)
+	return nil
+}
+
+// record is a saved session with times as offsets from the script start.
+type record struct {
+	Title       string
+	State       string
+	Start, End  time.Duration
+	Interrupted bool
+}
+
+func (r *recordingStorage) records(start time.Time) []record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var records []record
+	for _, stat := range r.saved {
+		records = append(records, record{
+			Title:       stat.Title,
+			State:       stat.State,
+			Start:       stat.Start.Sub(start),
+			End:         stat.Date.Sub(start),
+			Interrupted: stat.Interrupted,
+		})
+	}
+	return records
+}
+
+var scriptStart = time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+
+func win(title string) Window {
+	return Window{Title: title, Process: title + ".exe", PID: 1}
+}
+
+// runScript plays steps through a monitor until the script ends, stops it
+// and returns what it saved.
+func runScript(t *testing.T, idleThreshold time.Duration, steps ...ScriptStep) []record {
+	t.Helper()
+	source := NewScriptedSource(scriptStart, steps...)
+	db := &recordingStorage{}
+	m := NewWindowMonitor(db, source, nil)
+	m.SetClock(source)
+	if idleThreshold > 0 {
+		m.SetIdleDetector(source, idleThreshold)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Start()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return at the end of the script")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	return db.records(scriptStart)
+}
+
+func checkRecords(t *testing.T, got, want []record) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d records %+v, want %d %+v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSessionBoundaries(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []ScriptStep
+		want  []record
+	}{
+		{
+			name: "single window is closed on stop",
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 3 * time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 3 * time.Second},
+			},
+		},
+		{
+			name: "switch ends the session at the first sample of the next window",
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 2 * time.Second},
+				{Window: win("Browser"), Duration: 1500 * time.Millisecond},
+				{Window: win("Editor"), Duration: time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Browser", Start: 2 * time.Second, End: 3500 * time.Millisecond},
+				{Title: "Editor", Start: 3500 * time.Millisecond, End: 4500 * time.Millisecond},
+			},
+		},
+		{
+			name: "handle changes do not split a session",
+			steps: []ScriptStep{
+				{Window: Window{Title: "Editor", Process: "Editor.exe", PID: 1, Handle: 1}, Duration: time.Second},
+				{Window: Window{Title: "Editor", Process: "Editor.exe", PID: 1, Handle: 2}, Duration: time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+			},
+		},
+		{
+			name: "same title in another process is a new session",
+			steps: []ScriptStep{
+				{Window: Window{Title: "Untitled", Process: "a.exe", PID: 1}, Duration: time.Second},
+				{Window: Window{Title: "Untitled", Process: "b.exe", PID: 2}, Duration: time.Second},
+			},
+			want: []record{
+				{Title: "Untitled", Start: 0, End: time.Second},
+				{Title: "Untitled", Start: time.Second, End: 2 * time.Second},
+			},
+		},
+		{
+			name: "no active window keeps the last session open",
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: time.Second},
+				{Duration: time.Second},
+				{Window: win("Browser"), Duration: time.Second},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Browser", Start: 2 * time.Second, End: 3 * time.Second},
+			},
+		},
+		{
+			name: "switches shorter than the poll interval are missed",
+			steps: []ScriptStep{
+				{Window: win("Editor"), Duration: 1020 * time.Millisecond},
+				{Window: win("Popup"), Duration: 50 * time.Millisecond},
+				{Window: win("Editor"), Duration: 930 * time.Millisecond},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRecords(t, runScript(t, 0, tt.steps...), tt.want)
+		})
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	source := NewScriptedSource(scriptStart)
+	db := &recordingStorage{}
+	m := NewWindowMonitor(db, source, nil)
+	m.SetClock(source)
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	// Stop is idempotent and nothing was open
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+	if len(db.saved) != 0 {
+		t.Errorf("saved %+v, want nothing", db.saved)
+	}
+}
+
+func TestFlushKeepsSessionOpen(t *testing.T) {
+	source := NewScriptedSource(scriptStart, ScriptStep{Window: win("Editor"), Duration: 2 * time.Second})
+	db := &recordingStorage{}
+	m := NewWindowMonitor(db, source, nil)
+	m.SetClock(source)
+
+	m.observe(source.ActiveWindow())
+	source.Sleep(time.Second)
+	if err := m.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	source.Sleep(time.Second)
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	checkRecords(t, db.records(scriptStart), []record{
+		{Title: "Editor", Start: 0, End: time.Second},
+		{Title: "Editor", Start: time.Second, End: 2 * time.Second},
+	})
+}
+
+// stoppingSource stops the monitor once the script reaches at.
+type stoppingSource struct {
+	*ScriptedSource
+	m    *WindowMonitor
+	at   time.Time
+	once sync.Once
+}
+
+func (s *stoppingSource) ActiveWindow() (Window, error) {
+	if !s.Now().Before(s.at) {
+		s.once.Do(func() {
+			go s.m.Stop(context.Background())
+			<-s.m.stop
+		})
+	}
+	return s.ScriptedSource.ActiveWindow()
+}
+
+func TestStopClosesOpenSession(t *testing.T) {
+	script := NewScriptedSource(scriptStart,
+		ScriptStep{Window: win("Editor"), Duration: time.Second},
+		ScriptStep{Window: win("Browser"), Duration: time.Hour},
+	)
+	db := &recordingStorage{}
+	source := &stoppingSource{ScriptedSource: script, at: scriptStart.Add(1500 * time.Millisecond)}
+	m := NewWindowMonitor(db, source, nil)
+	source.m = m
+	m.SetClock(script)
+
+	m.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	// The last sample is taken at 1.5s and the loop notices the stop
+	// after sleeping one interval
+	checkRecords(t, db.records(scriptStart), []record{
+		{Title: "Editor", Start: 0, End: time.Second},
+		{Title: "Browser", Start: time.Second, End: 1600 * time.Millisecond},
+	})
+}
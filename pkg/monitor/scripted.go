@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ScriptStep keeps Window in the foreground for Duration. A step with an
+// empty title simulates having no active window, and an Idle step one
+// during which the user gave no input.
+type ScriptStep struct {
+	Window   Window
+	Duration time.Duration
+	Idle     bool
+}
+
+// ScriptedSource replays a fixed timeline of windows against a virtual
+// clock, so WindowMonitor can be driven deterministically without a desktop.
+// It implements WindowSource, IdleDetector and MonotonicClock; pass it to
+// SetClock and SetIdleDetector as well.
+type ScriptedSource struct {
+	mu    sync.Mutex
+	steps []ScriptStep
+	start time.Time
+	now   time.Time
+	// jumps are the wall clock changes made by Jump, at the time they
+	// ended
+	jumps []scriptJump
+}
+
+type scriptJump struct {
+	at time.Time
+	d  time.Duration
+}
+
+func NewScriptedSource(start time.Time, steps ...ScriptStep) *ScriptedSource {
+	return &ScriptedSource{
+		steps: steps,
+		start: start,
+		now:   start,
+	}
+}
+
+func (s *ScriptedSource) ActiveWindow() (Window, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at := s.start
+	for _, step := range s.steps {
+		at = at.Add(step.Duration)
+		if s.now.Before(at) {
+			if step.Window.Title == "" {
+				return Window{}, fmt.Errorf("no active window")
+			}
+			win := step.Window
+			win.Time = s.now
+			return win, nil
+		}
+	}
+	return Window{}, ErrSourceClosed
+}
+
+// IdleTime returns how long the script has been in consecutive Idle steps.
+func (s *ScriptedSource) IdleTime() (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at := s.start
+	var idleSince time.Time
+	for _, step := range s.steps {
+		if !step.Idle {
+			idleSince = time.Time{}
+		} else if idleSince.IsZero() {
+			idleSince = at
+		}
+		at = at.Add(step.Duration)
+		if s.now.Before(at) {
+			break
+		}
+	}
+	if idleSince.IsZero() {
+		return 0, nil
+	}
+	return s.now.Sub(idleSince), nil
+}
+
+func (s *ScriptedSource) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+// Sleep advances the virtual clock without blocking.
+func (s *ScriptedSource) Sleep(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// Jump moves the virtual wall clock by d while no monotonic time passes, as
+// when the system suspends or the clock is set.
+func (s *ScriptedSource) Jump(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+	s.jumps = append(s.jumps, scriptJump{at: s.now, d: d})
+}
+
+// Elapsed returns the time between from and to less the jumps made in
+// between.
+func (s *ScriptedSource) Elapsed(from, to time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := to.Sub(from)
+	for _, j := range s.jumps {
+		if j.at.After(from) && !j.at.After(to) {
+			elapsed -= j.d
+		}
+	}
+	return elapsed
+}
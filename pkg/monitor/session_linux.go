@@ -0,0 +1,153 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// LogindWatcher follows lock and suspend signals on D-Bus through
+// dbus-monitor: PrepareForSleep and Lock/Unlock from logind on the system
+// bus, and ActiveChanged from org.freedesktop.ScreenSaver on the session bus.
+// Lock/Unlock are only followed for the session this process runs in, as
+// logind sends them for every session on the seat.
+type LogindWatcher struct{}
+
+func (LogindWatcher) SessionEvents() (<-chan SessionEvent, error) {
+	rules := []string{"--system",
+		"type='signal',interface='org.freedesktop.login1.Manager',member='PrepareForSleep'"}
+	if path, err := logindSessionPath(); err != nil {
+		log.Printf("Not following logind lock signals: %v", err)
+	} else {
+		rules = append(rules,
+			"type='signal',interface='org.freedesktop.login1.Session',member='Lock',path='"+path+"'",
+			"type='signal',interface='org.freedesktop.login1.Session',member='Unlock',path='"+path+"'")
+	}
+	system := exec.Command("dbus-monitor", rules...)
+	session := exec.Command("dbus-monitor", "--session",
+		"type='signal',interface='org.freedesktop.ScreenSaver',member='ActiveChanged'")
+
+	ch := make(chan SessionEvent)
+	started := 0
+	done := make(chan struct{})
+	for _, cmd := range []*exec.Cmd{system, session} {
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			continue
+		}
+		started++
+		go func(cmd *exec.Cmd, out io.Reader) {
+			parseDBusSignals(out, ch)
+			cmd.Wait()
+			done <- struct{}{}
+		}(cmd, out)
+	}
+	if started == 0 {
+		return nil, fmt.Errorf("dbus-monitor unavailable")
+	}
+
+	go func() {
+		for i := 0; i < started; i++ {
+			<-done
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// logindSessionPath returns the logind object path of the session this
+// process runs in, from XDG_SESSION_ID or else by asking logind.
+func logindSessionPath() (string, error) {
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		return "/org/freedesktop/login1/session/" + escapeBusLabel(id), nil
+	}
+	out, err := exec.Command("dbus-send", "--system", "--print-reply=literal",
+		"--dest=org.freedesktop.login1", "/org/freedesktop/login1",
+		"org.freedesktop.login1.Manager.GetSessionByPID",
+		fmt.Sprintf("uint32:%d", os.Getpid())).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the logind session: %v", err)
+	}
+	// The literal reply is the bare object path
+	path := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(path, "/org/freedesktop/login1/session/") {
+		return "", fmt.Errorf("unexpected logind reply %q", out)
+	}
+	return path, nil
+}
+
+// escapeBusLabel escapes a session ID the way logind does in object paths:
+// anything but ASCII letters and digits, and a leading digit, becomes _
+// followed by two hex digits.
+func escapeBusLabel(s string) string {
+	if s == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		alpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		digit := c >= '0' && c <= '9'
+		if alpha || digit && i > 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// parseDBusSignals turns dbus-monitor's text output into session events.
+// Signal headers name the member; boolean arguments follow on their own
+// lines.
+func parseDBusSignals(r io.Reader, ch chan<- SessionEvent) {
+	var member string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "signal ") {
+			member = ""
+			if i := strings.Index(line, "member="); i >= 0 {
+				member = line[i+len("member="):]
+			}
+			switch member {
+			case "Lock":
+				ch <- SessionLocked
+			case "Unlock":
+				ch <- SessionUnlocked
+			}
+			continue
+		}
+
+		var on bool
+		switch line {
+		case "boolean true":
+			on = true
+		case "boolean false":
+		default:
+			continue
+		}
+		switch {
+		case member == "PrepareForSleep" && on:
+			ch <- SystemSuspending
+		case member == "PrepareForSleep":
+			ch <- SystemResumed
+		case member == "ActiveChanged" && on:
+			ch <- SessionLocked
+		case member == "ActiveChanged":
+			ch <- SessionUnlocked
+		}
+	}
+}
+
+// NewDefaultSessionWatcher returns the session watcher for this platform.
+func NewDefaultSessionWatcher() SessionWatcher {
+	return LogindWatcher{}
+}
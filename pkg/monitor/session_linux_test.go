@@ -0,0 +1,19 @@
+package monitor
+
+import "testing"
+
+func TestEscapeBusLabel(t *testing.T) {
+	for _, tt := range []struct {
+		id, want string
+	}{
+		{"2", "_32"},
+		{"c1", "c1"},
+		{"12", "_312"},
+		{"a-b", "a_2db"},
+		{"", "_"},
+	} {
+		if got := escapeBusLabel(tt.id); got != tt.want {
+			t.Errorf("escapeBusLabel(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// sessionStep delivers Event after the script has run for At.
+type sessionStep struct {
+	At    time.Duration
+	Event SessionEvent
+}
+
+func TestSessionEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []sessionStep
+		want   []record
+	}{
+		{
+			name:   "lock ends the session and unlock starts a new one",
+			events: []sessionStep{{2 * time.Second, SessionLocked}, {5 * time.Second, SessionUnlocked}},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Locked", State: storage.StateLocked, Start: 2 * time.Second, End: 5 * time.Second},
+				{Title: "Browser", Start: 5 * time.Second, End: 7 * time.Second},
+			},
+		},
+		{
+			name:   "suspend ends the session and resume starts a new one",
+			events: []sessionStep{{2 * time.Second, SystemSuspending}, {5 * time.Second, SystemResumed}},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Asleep", State: storage.StateAsleep, Start: 2 * time.Second, End: 5 * time.Second},
+				{Title: "Browser", Start: 5 * time.Second, End: 7 * time.Second},
+			},
+		},
+		{
+			name: "resume while locked waits for unlock",
+			events: []sessionStep{
+				{2 * time.Second, SessionLocked},
+				{3 * time.Second, SystemSuspending},
+				{4 * time.Second, SystemResumed},
+				{6 * time.Second, SessionUnlocked},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Locked", State: storage.StateLocked, Start: 2 * time.Second, End: 3 * time.Second},
+				{Title: "Asleep", State: storage.StateAsleep, Start: 3 * time.Second, End: 4 * time.Second},
+				{Title: "Locked", State: storage.StateLocked, Start: 4 * time.Second, End: 6 * time.Second},
+				{Title: "Browser", Start: 6 * time.Second, End: 7 * time.Second},
+			},
+		},
+		{
+			name: "locking while asleep stays asleep",
+			events: []sessionStep{
+				{2 * time.Second, SystemSuspending},
+				{3 * time.Second, SessionLocked},
+				{4 * time.Second, SystemResumed},
+				{5 * time.Second, SessionUnlocked},
+			},
+			want: []record{
+				{Title: "Editor", Start: 0, End: 2 * time.Second},
+				{Title: "Asleep", State: storage.StateAsleep, Start: 2 * time.Second, End: 4 * time.Second},
+				{Title: "Locked", State: storage.StateLocked, Start: 4 * time.Second, End: 5 * time.Second},
+				{Title: "Browser", Start: 5 * time.Second, End: 7 * time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewScriptedSource(scriptStart,
+				ScriptStep{Window: win("Editor"), Duration: 2 * time.Second},
+				ScriptStep{Window: win("Browser"), Duration: time.Hour},
+			)
+			db := &recordingStorage{}
+			m := NewWindowMonitor(db, source, nil)
+			m.SetClock(source)
+
+			// Sample every poll interval, delivering events as their time
+			// comes; samples while paused are ignored
+			end := 7 * time.Second
+			events := tt.events
+			for at := time.Duration(0); at < end; at += PollInterval {
+				for len(events) > 0 && events[0].At <= at {
+					ch := make(chan SessionEvent, 1)
+					ch <- events[0].Event
+					close(ch)
+					m.followSession(ch)
+					events = events[1:]
+				}
+				m.observe(source.ActiveWindow())
+				source.Sleep(PollInterval)
+			}
+			if err := m.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+			checkRecords(t, db.records(scriptStart), tt.want)
+		})
+	}
+}
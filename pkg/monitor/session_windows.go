@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	registerClassExW               = user32.NewProc("RegisterClassExW")
+	createWindowExW                = user32.NewProc("CreateWindowExW")
+	defWindowProcW                 = user32.NewProc("DefWindowProcW")
+	translateMessage               = user32.NewProc("TranslateMessage")
+	dispatchMessageW               = user32.NewProc("DispatchMessageW")
+	getModuleHandleW               = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetModuleHandleW")
+	wtsRegisterSessionNotification = windows.NewLazySystemDLL("wtsapi32.dll").NewProc("WTSRegisterSessionNotification")
+)
+
+const (
+	wmWTSSessionChange    = 0x02B1
+	wmPowerBroadcast      = 0x0218
+	wtsSessionLock        = 0x7
+	wtsSessionUnlock      = 0x8
+	pbtAPMSuspend         = 0x4
+	pbtAPMResumeSuspend   = 0x7
+	pbtAPMResumeAutomatic = 0x12
+	notifyForThisSession  = 0
+)
+
+type wndClassEx struct {
+	cbSize        uint32
+	style         uint32
+	lpfnWndProc   uintptr
+	cbClsExtra    int32
+	cbWndExtra    int32
+	hInstance     windows.Handle
+	hIcon         windows.Handle
+	hCursor       windows.Handle
+	hbrBackground windows.Handle
+	lpszMenuName  *uint16
+	lpszClassName *uint16
+	hIconSm       windows.Handle
+}
+
+// WTSWatcher receives session lock and power notifications through a
+// hidden window. WM_POWERBROADCAST is only sent to top-level windows, so it
+// cannot be a message-only window.
+type WTSWatcher struct{}
+
+func (WTSWatcher) SessionEvents() (<-chan SessionEvent, error) {
+	ch := make(chan SessionEvent)
+	started := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(ch)
+
+		wndProc := windows.NewCallback(func(hwnd, msg, wParam, lParam uintptr) uintptr {
+			switch msg {
+			case wmWTSSessionChange:
+				switch wParam {
+				case wtsSessionLock:
+					ch <- SessionLocked
+				case wtsSessionUnlock:
+					ch <- SessionUnlocked
+				}
+			case wmPowerBroadcast:
+				switch wParam {
+				case pbtAPMSuspend:
+					ch <- SystemSuspending
+				case pbtAPMResumeSuspend, pbtAPMResumeAutomatic:
+					ch <- SystemResumed
+				}
+				return 1
+			}
+			ret, _, _ := defWindowProcW.Call(hwnd, msg, wParam, lParam)
+			return ret
+		})
+
+		instance, _, _ := getModuleHandleW.Call(0)
+		className, _ := windows.UTF16PtrFromString("WindowMonitorSession")
+		wc := wndClassEx{
+			lpfnWndProc:   wndProc,
+			hInstance:     windows.Handle(instance),
+			lpszClassName: className,
+		}
+		wc.cbSize = uint32(unsafe.Sizeof(wc))
+		if ret, _, err := registerClassExW.Call(uintptr(unsafe.Pointer(&wc))); ret == 0 {
+			started <- fmt.Errorf("RegisterClassExW failed: %v", err)
+			return
+		}
+
+		hwnd, _, err := createWindowExW.Call(0,
+			uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+			0, 0, 0, 0, 0, 0, 0, instance, 0)
+		if hwnd == 0 {
+			started <- fmt.Errorf("CreateWindowExW failed: %v", err)
+			return
+		}
+		if ret, _, err := wtsRegisterSessionNotification.Call(hwnd, notifyForThisSession); ret == 0 {
+			started <- fmt.Errorf("WTSRegisterSessionNotification failed: %v", err)
+			return
+		}
+		started <- nil
+
+		var msg [48]byte
+		for {
+			ret, _, _ := getMessageW.Call(uintptr(unsafe.Pointer(&msg[0])), 0, 0, 0)
+			if int32(ret) <= 0 {
+				return
+			}
+			translateMessage.Call(uintptr(unsafe.Pointer(&msg[0])))
+			dispatchMessageW.Call(uintptr(unsafe.Pointer(&msg[0])))
+		}
+	}()
+
+	if err := <-started; err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// NewDefaultSessionWatcher returns the session watcher for this platform.
+func NewDefaultSessionWatcher() SessionWatcher {
+	return WTSWatcher{}
+}
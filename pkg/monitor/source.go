@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSourceClosed is returned by a WindowSource that has no more windows to
+// report. WindowMonitor.Start returns when it sees it.
+var ErrSourceClosed = errors.New("window source closed")
+
+// Window is a snapshot of the foreground window at a point in time.
+type Window struct {
+	Title   string
+	Handle  uintptr
+	Process string
+	PID     uint32
+	Class   string
+	Time    time.Time
+}
+
+// WindowSource reports the window that currently has focus.
+type WindowSource interface {
+	ActiveWindow() (Window, error)
+}
+
+// EventSource is a WindowSource that can push focus and title changes
+// instead of being polled. The channel receives the current window first
+// and is closed when the source goes away.
+type EventSource interface {
+	WindowSource
+	Events() (<-chan Window, error)
+}
+
+// eventBuffer is how many pushed windows an event source holds for a
+// consumer that has fallen behind.
+const eventBuffer = 16
+
+// sendLatest delivers win to ch without blocking. If ch is full the oldest
+// pending window is dropped: the newest one is what the consumer needs to
+// end the open session, and a consumer that stopped reading, such as a
+// stopped WindowMonitor, must not hang the goroutine that reads events.
+func sendLatest(ch chan Window, win Window) {
+	for {
+		select {
+		case ch <- win:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+// IdleDetector reports how long it has been since the last keyboard or
+// mouse input.
+type IdleDetector interface {
+	IdleTime() (time.Duration, error)
+}
+
+// SessionEvent is a change in the user session that interrupts tracking.
+type SessionEvent int
+
+const (
+	SessionLocked SessionEvent = iota
+	SessionUnlocked
+	SystemSuspending
+	SystemResumed
+)
+
+// SessionWatcher reports session lock and system suspend events.
+type SessionWatcher interface {
+	SessionEvents() (<-chan SessionEvent, error)
+}
+
+// Clock lets the polling loop run against something other than wall time.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// MonotonicClock is a Clock whose readings carry no monotonic time. It
+// reports instead how much monotonic time, which stands still during
+// suspend and ignores wall clock changes, passed between two readings.
+type MonotonicClock interface {
+	Clock
+	Elapsed(from, to time.Time) time.Duration
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
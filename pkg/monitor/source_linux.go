@@ -0,0 +1,219 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windowmonitor/pkg/x11"
+)
+
+// X11Source reads the foreground window from an EWMH-compliant window
+// manager through _NET_ACTIVE_WINDOW. It can be polled, or push changes
+// through Events using PropertyNotify on the root and active windows.
+type X11Source struct {
+	mu           sync.Mutex
+	conn         *x11.Conn
+	display      string
+	events       *x11.Conn
+	activeWindow x11.Atom
+	wmName       x11.Atom
+	wmPID        x11.Atom
+	utf8String   x11.Atom
+}
+
+// NewX11Source connects to display, or $DISPLAY if empty.
+func NewX11Source(display string) (*X11Source, error) {
+	conn, err := x11.Dial(display)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &X11Source{conn: conn, display: display}
+	for name, atom := range map[string]*x11.Atom{
+		"_NET_ACTIVE_WINDOW": &s.activeWindow,
+		"_NET_WM_NAME":       &s.wmName,
+		"_NET_WM_PID":        &s.wmPID,
+		"UTF8_STRING":        &s.utf8String,
+	} {
+		if *atom, err = conn.InternAtom(name); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to intern %s: %v", name, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *X11Source) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.events != nil {
+		s.events.Close()
+	}
+	return s.conn.Close()
+}
+
+func (s *X11Source) ActiveWindow() (Window, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	prop, err := s.conn.GetProperty(s.conn.Root(), s.activeWindow)
+	if err != nil {
+		return Window{}, err
+	}
+	wid := x11.Window(prop.Uint32())
+	if wid == 0 {
+		return Window{}, fmt.Errorf("no active window")
+	}
+
+	title, err := s.windowTitle(wid)
+	if err != nil {
+		return Window{}, err
+	}
+
+	var pid uint32
+	if prop, err := s.conn.GetProperty(wid, s.wmPID); err == nil {
+		pid = prop.Uint32()
+	}
+
+	var class string
+	if prop, err := s.conn.GetProperty(wid, x11.AtomWMClass); err == nil {
+		class = windowClass(prop.Value)
+	}
+
+	return Window{
+		Title:   title,
+		Handle:  uintptr(wid),
+		Process: processName(pid),
+		PID:     pid,
+		Class:   class,
+		Time:    now,
+	}, nil
+}
+
+// Events opens a second connection that listens for PropertyNotify on the
+// root window (focus changes) and on the active window (title changes).
+func (s *X11Source) Events() (<-chan Window, error) {
+	conn, err := x11.Dial(s.display)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SelectEvents(conn.Root(), x11.PropertyChangeMask); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.events = conn
+	s.mu.Unlock()
+
+	ch := make(chan Window, eventBuffer)
+	go s.readEvents(conn, ch)
+	return ch, nil
+}
+
+// readEvents forwards changes until the event connection is closed. It
+// never waits for the consumer, which may have stopped reading.
+func (s *X11Source) readEvents(conn *x11.Conn, ch chan Window) {
+	defer close(ch)
+
+	var watched x11.Window
+	emit := func() {
+		win, err := s.ActiveWindow()
+		if err != nil {
+			return
+		}
+		// Follow title changes of the newly focused window only
+		if wid := x11.Window(win.Handle); wid != watched {
+			if watched != 0 {
+				conn.SelectEvents(watched, 0)
+			}
+			conn.SelectEvents(wid, x11.PropertyChangeMask)
+			watched = wid
+			// Once the server has the selection, read the window again
+			// so that a title change made in between is not missed
+			if _, err := conn.GetProperty(wid, s.wmName); err == nil {
+				if again, err := s.ActiveWindow(); err == nil {
+					win = again
+				}
+			}
+		}
+		sendLatest(ch, win)
+	}
+
+	emit()
+	for {
+		ev, err := conn.NextEvent()
+		if err != nil {
+			var xerr *x11.Error
+			if errors.As(err, &xerr) {
+				// The watched window was destroyed before we deselected it
+				continue
+			}
+			return
+		}
+		if ev.Code != x11.PropertyNotify {
+			continue
+		}
+		switch {
+		case ev.Window == conn.Root() && ev.Atom == s.activeWindow:
+			emit()
+		case ev.Window == watched && (ev.Atom == s.wmName || ev.Atom == x11.AtomWMName):
+			emit()
+		}
+	}
+}
+
+// windowClass returns the class part of a WM_CLASS value, which holds the
+// NUL-terminated instance and class names back to back.
+func windowClass(value []byte) string {
+	parts := strings.Split(strings.TrimRight(string(value), "\x00"), "\x00")
+	return parts[len(parts)-1]
+}
+
+// windowTitle prefers the UTF-8 _NET_WM_NAME and falls back to WM_NAME.
+func (s *X11Source) windowTitle(wid x11.Window) (string, error) {
+	prop, err := s.conn.GetProperty(wid, s.wmName)
+	if err != nil {
+		return "", err
+	}
+	if prop.Type == s.utf8String && len(prop.Value) > 0 {
+		return string(prop.Value), nil
+	}
+	prop, err = s.conn.GetProperty(wid, x11.AtomWMName)
+	if err != nil {
+		return "", err
+	}
+	return string(prop.Value), nil
+}
+
+// processName returns the executable name of pid from /proc.
+func processName(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	proc := filepath.Join("/proc", strconv.FormatUint(uint64(pid), 10))
+	if exe, err := os.Readlink(filepath.Join(proc, "exe")); err == nil {
+		return filepath.Base(exe)
+	}
+	if comm, err := os.ReadFile(filepath.Join(proc, "comm")); err == nil {
+		return strings.TrimSpace(string(comm))
+	}
+	return ""
+}
+
+// NewDefaultSource returns the window source for this platform: sway IPC
+// when running under a sway-compatible Wayland compositor, X11 otherwise.
+func NewDefaultSource() (WindowSource, error) {
+	if os.Getenv("SWAYSOCK") != "" {
+		return NewSwaySource("")
+	}
+	return NewX11Source("")
+}
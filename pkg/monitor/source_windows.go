@@ -0,0 +1,185 @@
+package monitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                   = windows.NewLazyDLL("user32.dll")
+	getForegroundWindow      = user32.NewProc("GetForegroundWindow")
+	getWindowTextW           = user32.NewProc("GetWindowTextW")
+	getWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	getClassNameW            = user32.NewProc("GetClassNameW")
+	setWinEventHook          = user32.NewProc("SetWinEventHook")
+	unhookWinEvent           = user32.NewProc("UnhookWinEvent")
+	getMessageW              = user32.NewProc("GetMessageW")
+	postThreadMessageW       = user32.NewProc("PostThreadMessageW")
+)
+
+const (
+	eventSystemForeground = 0x0003
+	eventObjectNameChange = 0x800C
+	winEventOutOfContext  = 0x0000
+	objIDWindow           = 0
+	wmQuit                = 0x0012
+)
+
+// Win32Source reads the foreground window through the Win32 API. It can be
+// polled, or push changes through Events using SetWinEventHook.
+type Win32Source struct {
+	mu       sync.Mutex
+	threadID uint32
+}
+
+func NewWin32Source() *Win32Source {
+	return &Win32Source{}
+}
+
+// Close stops the event hook thread, if Events was called.
+func (s *Win32Source) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.threadID != 0 {
+		postThreadMessageW.Call(uintptr(s.threadID), wmQuit, 0, 0)
+		s.threadID = 0
+	}
+	return nil
+}
+
+// Events installs out-of-context WinEvent hooks for foreground and title
+// changes. The hooks need a message loop on the thread that installed them,
+// so they run on a dedicated locked OS thread.
+func (s *Win32Source) Events() (<-chan Window, error) {
+	ch := make(chan Window, eventBuffer)
+	started := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(ch)
+
+		callback := windows.NewCallback(func(hook, event, hwnd, idObject, idChild, thread, eventTime uintptr) uintptr {
+			if event == eventObjectNameChange {
+				// Only title changes of the foreground window itself matter
+				fg, _, _ := getForegroundWindow.Call()
+				if hwnd != fg || int32(idObject) != objIDWindow {
+					return 0
+				}
+			}
+			// Never block the message loop, or Close's WM_QUIT is not seen
+			if win, err := s.ActiveWindow(); err == nil {
+				sendLatest(ch, win)
+			}
+			return 0
+		})
+
+		var hooks []uintptr
+		for _, event := range []uintptr{eventSystemForeground, eventObjectNameChange} {
+			hook, _, err := setWinEventHook.Call(event, event, 0, callback, 0, 0, winEventOutOfContext)
+			if hook == 0 {
+				for _, h := range hooks {
+					unhookWinEvent.Call(h)
+				}
+				started <- fmt.Errorf("SetWinEventHook failed: %v", err)
+				return
+			}
+			hooks = append(hooks, hook)
+		}
+		defer func() {
+			for _, h := range hooks {
+				unhookWinEvent.Call(h)
+			}
+		}()
+
+		s.mu.Lock()
+		s.threadID = windows.GetCurrentThreadId()
+		s.mu.Unlock()
+		started <- nil
+
+		if win, err := s.ActiveWindow(); err == nil {
+			sendLatest(ch, win)
+		}
+
+		// Pump messages so the hook callbacks get delivered
+		var msg [48]byte
+		for {
+			ret, _, _ := getMessageW.Call(uintptr(unsafe.Pointer(&msg[0])), 0, 0, 0)
+			if int32(ret) <= 0 {
+				return
+			}
+		}
+	}()
+
+	if err := <-started; err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (s *Win32Source) ActiveWindow() (Window, error) {
+	now := time.Now()
+	hwnd, _, _ := getForegroundWindow.Call()
+	if hwnd == 0 {
+		return Window{}, fmt.Errorf("no active window")
+	}
+
+	buf := make([]uint16, 256)
+	_, _, _ = getWindowTextW.Call(
+		hwnd,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+	)
+
+	class := make([]uint16, 256)
+	_, _, _ = getClassNameW.Call(
+		hwnd,
+		uintptr(unsafe.Pointer(&class[0])),
+		uintptr(len(class)),
+	)
+
+	var pid uint32
+	_, _, _ = getWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+
+	return Window{
+		Title:   syscall.UTF16ToString(buf),
+		Handle:  hwnd,
+		Process: processImageName(pid),
+		PID:     pid,
+		Class:   syscall.UTF16ToString(class),
+		Time:    now,
+	}, nil
+}
+
+// processImageName returns the executable name of the process, or an empty
+// string if the process cannot be opened (e.g. elevated processes).
+func processImageName(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err != nil {
+		return ""
+	}
+	return filepath.Base(windows.UTF16ToString(buf[:size]))
+}
+
+// NewDefaultSource returns the window source for this platform.
+func NewDefaultSource() (WindowSource, error) {
+	return NewWin32Source(), nil
+}
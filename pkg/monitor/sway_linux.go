@@ -0,0 +1,305 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// sway IPC message types, see sway-ipc(7).
+const (
+	swayMsgSubscribe   = 2
+	swayMsgGetTree     = 4
+	swayEventWorkspace = 0x80000000
+	swayEventWindow    = 0x80000003
+)
+
+var swayMagic = []byte("i3-ipc")
+
+// swayNode is the subset of a sway tree node we care about.
+type swayNode struct {
+	ID               int64      `json:"id"`
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	Focused          bool       `json:"focused"`
+	PID              uint32     `json:"pid"`
+	AppID            string     `json:"app_id"`
+	Nodes            []swayNode `json:"nodes"`
+	FloatingNodes    []swayNode `json:"floating_nodes"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+}
+
+type swayWindowEvent struct {
+	Change    string   `json:"change"`
+	Container swayNode `json:"container"`
+}
+
+type swayWorkspaceEvent struct {
+	Change string `json:"change"`
+}
+
+// SwaySource tracks the focused window of a Wayland compositor speaking the
+// sway IPC protocol. Instead of querying on every poll it subscribes to
+// window events and keeps the focused window cached; the same events are
+// forwarded to the channel returned by Events.
+type SwaySource struct {
+	cmd    net.Conn
+	events net.Conn
+
+	mu      sync.Mutex
+	focused *swayNode
+	err     error
+	ch      chan Window
+}
+
+// NewSwaySource connects to the IPC socket at path, or $SWAYSOCK if empty.
+func NewSwaySource(path string) (*SwaySource, error) {
+	if path == "" {
+		path = os.Getenv("SWAYSOCK")
+	}
+	if path == "" {
+		return nil, errors.New("SWAYSOCK not set")
+	}
+
+	cmd, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to sway: %v", err)
+	}
+	events, err := net.Dial("unix", path)
+	if err != nil {
+		cmd.Close()
+		return nil, fmt.Errorf("failed to connect to sway: %v", err)
+	}
+
+	s := &SwaySource{cmd: cmd, events: events}
+	if err := s.subscribe(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if err := s.refresh(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	go s.readEvents()
+	return s, nil
+}
+
+func (s *SwaySource) Close() error {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = ErrSourceClosed
+	}
+	s.mu.Unlock()
+
+	s.events.Close()
+	return s.cmd.Close()
+}
+
+func (s *SwaySource) ActiveWindow() (Window, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeWindowLocked()
+}
+
+// Events returns a channel that receives the focused window every time it
+// or its title changes. An empty Window means nothing has focus.
+func (s *SwaySource) Events() (<-chan Window, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.ch == nil {
+		s.ch = make(chan Window, eventBuffer)
+		win, _ := s.activeWindowLocked()
+		sendLatest(s.ch, win)
+	}
+	return s.ch, nil
+}
+
+func (s *SwaySource) activeWindowLocked() (Window, error) {
+	if s.err != nil {
+		return Window{}, s.err
+	}
+	if s.focused == nil {
+		return Window{}, fmt.Errorf("no active window")
+	}
+	// Native Wayland clients have an app_id, XWayland ones an X11 class
+	class := s.focused.AppID
+	if class == "" {
+		class = s.focused.WindowProperties.Class
+	}
+	return Window{
+		Title:   s.focused.Name,
+		Handle:  uintptr(s.focused.ID),
+		Process: processName(s.focused.PID),
+		PID:     s.focused.PID,
+		Class:   class,
+		Time:    time.Now(),
+	}, nil
+}
+
+func (s *SwaySource) subscribe() error {
+	if err := writeSwayMessage(s.events, swayMsgSubscribe, []byte(`["window","workspace"]`)); err != nil {
+		return err
+	}
+	_, payload, err := readSwayMessage(s.events)
+	if err != nil {
+		return err
+	}
+	var reply struct {
+		Success bool `json:"success"`
+	}
+	if err := json.Unmarshal(payload, &reply); err != nil || !reply.Success {
+		return fmt.Errorf("sway rejected subscription: %s", payload)
+	}
+	return nil
+}
+
+// refresh re-reads the focused window from the full tree.
+func (s *SwaySource) refresh() error {
+	if err := writeSwayMessage(s.cmd, swayMsgGetTree, nil); err != nil {
+		return err
+	}
+	_, payload, err := readSwayMessage(s.cmd)
+	if err != nil {
+		return err
+	}
+	var root swayNode
+	if err := json.Unmarshal(payload, &root); err != nil {
+		return fmt.Errorf("failed to parse sway tree: %v", err)
+	}
+
+	s.mu.Lock()
+	s.focused = findFocused(&root)
+	s.mu.Unlock()
+	s.publish()
+	return nil
+}
+
+// publish forwards the focused window to the Events channel, if any,
+// without waiting for it to be read.
+func (s *SwaySource) publish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != nil {
+		win, _ := s.activeWindowLocked()
+		sendLatest(s.ch, win)
+	}
+}
+
+// findFocused returns the focused view in the tree, ignoring focused
+// workspaces and outputs.
+func findFocused(n *swayNode) *swayNode {
+	if n.Focused && (n.Type == "con" || n.Type == "floating_con") {
+		return n
+	}
+	for _, children := range [][]swayNode{n.Nodes, n.FloatingNodes} {
+		for i := range children {
+			if f := findFocused(&children[i]); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SwaySource) readEvents() {
+	for {
+		typ, payload, err := readSwayMessage(s.events)
+		if err != nil {
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = ErrSourceClosed
+			}
+			if s.ch != nil {
+				close(s.ch)
+			}
+			s.mu.Unlock()
+			return
+		}
+
+		switch typ {
+		case swayEventWindow:
+			var ev swayWindowEvent
+			if err := json.Unmarshal(payload, &ev); err != nil {
+				continue
+			}
+			if s.handleWindowEvent(ev) {
+				s.publish()
+			}
+		case swayEventWorkspace:
+			var ev swayWorkspaceEvent
+			if err := json.Unmarshal(payload, &ev); err == nil && ev.Change == "focus" {
+				// Switching to an empty workspace sends no window event
+				if err := s.refresh(); err != nil {
+					fmt.Printf("Error refreshing sway tree: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// handleWindowEvent updates the focused window and reports whether it
+// changed.
+func (s *SwaySource) handleWindowEvent(ev swayWindowEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	isFocused := s.focused != nil && s.focused.ID == ev.Container.ID
+	switch ev.Change {
+	case "focus":
+		s.focused = &ev.Container
+		return true
+	case "title":
+		if isFocused {
+			s.focused = &ev.Container
+			return true
+		}
+	case "close":
+		if isFocused {
+			s.focused = nil
+			return true
+		}
+	}
+	return false
+}
+
+func writeSwayMessage(w io.Writer, typ uint32, payload []byte) error {
+	buf := make([]byte, 0, len(swayMagic)+8+len(payload))
+	buf = append(buf, swayMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.LittleEndian.AppendUint32(buf, typ)
+	buf = append(buf, payload...)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write sway message: %v", err)
+	}
+	return nil
+}
+
+func readSwayMessage(r io.Reader) (uint32, []byte, error) {
+	head := make([]byte, len(swayMagic)+8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, nil, err
+	}
+	if string(head[:len(swayMagic)]) != string(swayMagic) {
+		return 0, nil, errors.New("invalid sway IPC magic")
+	}
+	size := binary.LittleEndian.Uint32(head[len(swayMagic):])
+	typ := binary.LittleEndian.Uint32(head[len(swayMagic)+4:])
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return typ, payload, nil
+}
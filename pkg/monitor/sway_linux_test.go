@@ -0,0 +1,375 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSway stands in for the compositor: it answers get_tree with tree and
+// subscribe with success, and sends events to subscribed connections.
+type fakeSway struct {
+	t    *testing.T
+	path string
+	ln   net.Listener
+
+	mu         sync.Mutex
+	tree       swayNode
+	subscribed []net.Conn
+	treeCalls  int
+	ready      chan struct{}
+}
+
+func newFakeSway(t *testing.T, tree swayNode) *fakeSway {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sway-ipc.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	f := &fakeSway{t: t, path: path, ln: ln, tree: tree, ready: make(chan struct{}, 1)}
+	t.Cleanup(f.close)
+	go f.accept()
+	return f
+}
+
+func (f *fakeSway) accept() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.serve(conn)
+	}
+}
+
+func (f *fakeSway) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		typ, payload, err := readSwayMessage(conn)
+		if err != nil {
+			return
+		}
+		var reply []byte
+		switch typ {
+		case swayMsgSubscribe:
+			var events []string
+			if err := json.Unmarshal(payload, &events); err != nil {
+				reply = []byte(`{"success":false}`)
+				break
+			}
+			// Register only after the reply, so no event can overtake it
+			f.mu.Lock()
+			err = writeSwayMessage(conn, typ, []byte(`{"success":true}`))
+			f.subscribed = append(f.subscribed, conn)
+			f.mu.Unlock()
+			if err != nil {
+				return
+			}
+			select {
+			case f.ready <- struct{}{}:
+			default:
+			}
+			continue
+		case swayMsgGetTree:
+			f.mu.Lock()
+			f.treeCalls++
+			reply, _ = json.Marshal(f.tree)
+			f.mu.Unlock()
+		default:
+			reply = []byte(`{"success":false}`)
+		}
+		// Subscribers get events on the same connection; keep writes whole
+		f.mu.Lock()
+		err = writeSwayMessage(conn, typ, reply)
+		f.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeSway) setTree(tree swayNode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tree = tree
+}
+
+func (f *fakeSway) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.treeCalls
+}
+
+// send writes an event to every subscriber.
+func (f *fakeSway) send(typ uint32, event any) {
+	f.t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.subscribed {
+		if err := writeSwayMessage(conn, typ, payload); err != nil {
+			f.t.Fatalf("failed to send event: %v", err)
+		}
+	}
+}
+
+func (f *fakeSway) windowEvent(change string, con swayNode) {
+	f.t.Helper()
+	f.send(swayEventWindow, swayWindowEvent{Change: change, Container: con})
+}
+
+// close stops listening and hangs up on subscribers, as sway does when it
+// exits.
+func (f *fakeSway) close() {
+	f.ln.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.subscribed {
+		conn.Close()
+	}
+	f.subscribed = nil
+}
+
+func view(id int64, name, appID string) swayNode {
+	return swayNode{ID: id, Name: name, Type: "con", AppID: appID}
+}
+
+// tree returns a sway tree with one output and workspace holding views, of
+// which the one with focused as ID has focus.
+func tree(focused int64, views ...swayNode) swayNode {
+	ws := swayNode{ID: 2, Name: "1", Type: "workspace", Focused: focused == 0}
+	for _, v := range views {
+		v.Focused = v.ID == focused
+		ws.Nodes = append(ws.Nodes, v)
+	}
+	output := swayNode{ID: 1, Name: "eDP-1", Type: "output", Nodes: []swayNode{ws}}
+	return swayNode{ID: 0, Name: "root", Type: "root", Nodes: []swayNode{output}}
+}
+
+func openSway(t *testing.T, f *fakeSway) *SwaySource {
+	t.Helper()
+	s, err := NewSwaySource(f.path)
+	if err != nil {
+		t.Fatalf("NewSwaySource: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	select {
+	case <-f.ready:
+	case <-time.After(time.Second):
+		t.Fatal("source did not subscribe")
+	}
+	return s
+}
+
+func nextWindow(t *testing.T, ch <-chan Window) Window {
+	t.Helper()
+	select {
+	case win, ok := <-ch:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		win.Time = time.Time{}
+		return win
+	case <-time.After(2 * time.Second):
+		t.Fatal("no window event")
+	}
+	return Window{}
+}
+
+func TestSwayActiveWindow(t *testing.T) {
+	xterm := view(5, "xterm", "")
+	xterm.WindowProperties.Class = "XTerm"
+	f := newFakeSway(t, tree(5, view(4, "foot", "foot"), xterm))
+	s := openSway(t, f)
+
+	win, err := s.ActiveWindow()
+	if err != nil {
+		t.Fatalf("ActiveWindow: %v", err)
+	}
+	if win.Title != "xterm" || win.Handle != 5 || win.Class != "XTerm" {
+		t.Errorf("ActiveWindow = %+v, want xterm with its X11 class", win)
+	}
+}
+
+func TestSwayEvents(t *testing.T) {
+	editor := view(4, "main.go", "editor")
+	browser := view(5, "News", "browser")
+	f := newFakeSway(t, tree(4, editor, browser))
+	s := openSway(t, f)
+
+	events, err := s.Events()
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	if win := nextWindow(t, events); win.Title != "main.go" || win.Class != "editor" {
+		t.Fatalf("first event = %+v, want the focused editor", win)
+	}
+
+	f.windowEvent("focus", browser)
+	if win := nextWindow(t, events); win.Title != "News" || win.Handle != 5 {
+		t.Errorf("after focus event got %+v, want the browser", win)
+	}
+
+	// Title changes of other windows are ignored
+	editor.Name = "util.go"
+	f.windowEvent("title", editor)
+	browser.Name = "Weather"
+	f.windowEvent("title", browser)
+	if win := nextWindow(t, events); win.Title != "Weather" {
+		t.Errorf("after title event got %+v, want the new browser title", win)
+	}
+
+	f.windowEvent("close", browser)
+	if win := nextWindow(t, events); win.Title != "" {
+		t.Errorf("after closing the focused window got %+v, want no window", win)
+	}
+	if _, err := s.ActiveWindow(); err == nil {
+		t.Error("ActiveWindow succeeded with nothing focused")
+	}
+
+	// Moving to another workspace rereads the tree, which may have no
+	// focused view at all
+	calls := f.calls()
+	f.setTree(tree(0))
+	f.send(swayEventWorkspace, swayWorkspaceEvent{Change: "focus"})
+	if win := nextWindow(t, events); win.Title != "" {
+		t.Errorf("after workspace focus got %+v, want no window", win)
+	}
+	if f.calls() != calls+1 {
+		t.Errorf("get_tree called %d times on workspace focus, want once", f.calls()-calls)
+	}
+}
+
+func TestSwayClosedByCompositor(t *testing.T) {
+	f := newFakeSway(t, tree(4, view(4, "foot", "foot")))
+	s := openSway(t, f)
+	events, err := s.Events()
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	nextWindow(t, events)
+
+	f.close()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("got an event after the compositor went away")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event channel not closed")
+	}
+	if _, err := s.ActiveWindow(); !errors.Is(err, ErrSourceClosed) {
+		t.Errorf("ActiveWindow error = %v, want ErrSourceClosed", err)
+	}
+}
+
+// A monitor that stops reading must not block the goroutine that reads
+// events, or the cached window goes stale and Close cannot finish it.
+func TestSwayUnreadEvents(t *testing.T) {
+	f := newFakeSway(t, tree(1, view(1, "window 1", "app")))
+	s := openSway(t, f)
+	events, err := s.Events()
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+
+	const last = 3 * eventBuffer
+	for i := int64(2); i <= last; i++ {
+		f.windowEvent("focus", view(i, "window", "app"))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		win, err := s.ActiveWindow()
+		if err == nil && win.Handle == last {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ActiveWindow = %+v, %v; events stopped being read", win, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The newest window is still delivered
+	var win Window
+	for len(events) > 0 {
+		win = <-events
+	}
+	if win.Handle != last {
+		t.Errorf("last pending event = %+v, want window %d", win, last)
+	}
+
+	s.Close()
+	select {
+	case <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event channel not closed after Close")
+	}
+}
+
+func TestSwayMonitorStop(t *testing.T) {
+	f := newFakeSway(t, tree(1, view(1, "foot", "foot")))
+	s := openSway(t, f)
+	db := &recordingStorage{}
+	m := NewWindowMonitor(db, s, nil)
+
+	done := make(chan struct{})
+	go func() {
+		m.Start()
+		close(done)
+	}()
+	waitStatus(t, m, "foot")
+	f.windowEvent("focus", view(2, "editor", "editor"))
+	waitStatus(t, m, "editor")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	<-done
+
+	// Events keep being consumed after the monitor is gone
+	for i := int64(3); i < 3+2*eventBuffer; i++ {
+		f.windowEvent("focus", view(i, "window", "app"))
+	}
+	f.windowEvent("focus", view(100, "final", "app"))
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if win, err := s.ActiveWindow(); err == nil && win.Handle == 100 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("source stopped reading events after the monitor stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var titles []string
+	for _, r := range db.records(time.Time{}) {
+		titles = append(titles, r.Title)
+	}
+	if len(titles) != 2 || titles[0] != "foot" || titles[1] != "editor" {
+		t.Errorf("saved sessions %v, want foot then editor", titles)
+	}
+}
+
+// waitStatus waits until m reports title as the focused window.
+func waitStatus(t *testing.T, m *WindowMonitor, title string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Status().Window.Title != title {
+		if time.Now().After(deadline) {
+			t.Fatalf("monitor status is %+v, want %s", m.Status(), title)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
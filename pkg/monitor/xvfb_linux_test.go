@@ -0,0 +1,282 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windowmonitor/pkg/x11"
+)
+
+// startXvfb starts a private Xvfb and returns its display name. The test is
+// skipped if Xvfb is not installed.
+func startXvfb(t *testing.T) string {
+	t.Helper()
+	path, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	// Do not offer the user's cookies to the test server
+	t.Setenv("XAUTHORITY", os.DevNull)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Xvfb picks a free display and writes its number to fd 3 once it
+	// accepts connections
+	cmd := exec.Command(path, "-displayfd", "3", "-nolisten", "tcp", "-screen", "0", "640x480x24")
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		t.Fatalf("failed to start Xvfb: %v", err)
+	}
+	w.Close()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	number := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		number <- strings.TrimSpace(line)
+	}()
+	select {
+	case n := <-number:
+		if n == "" {
+			t.Fatal("Xvfb exited without reporting a display")
+		}
+		return ":" + n
+	case <-time.After(10 * time.Second):
+		t.Fatal("Xvfb did not start")
+	}
+	return ""
+}
+
+// fakeWM plays an EWMH window manager: it creates windows with the
+// properties a real one would read and points _NET_ACTIVE_WINDOW at them.
+type fakeWM struct {
+	t *testing.T
+	x *xWindows
+	// atoms by name
+	atoms map[string]x11.Atom
+}
+
+func newFakeWM(t *testing.T, display string) *fakeWM {
+	t.Helper()
+	// Atoms are shared by all clients, so the read-only client can look
+	// them up
+	conn, err := x11.Dial(display)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", display, err)
+	}
+	defer conn.Close()
+
+	wm := &fakeWM{t: t, x: dialXWindows(t, display), atoms: make(map[string]x11.Atom)}
+	for _, name := range []string{"_NET_ACTIVE_WINDOW", "_NET_WM_NAME", "_NET_WM_PID", "UTF8_STRING"} {
+		if wm.atoms[name], err = conn.InternAtom(name); err != nil {
+			t.Fatalf("failed to intern %s: %v", name, err)
+		}
+	}
+	return wm
+}
+
+// newWindow creates a window with a UTF-8 title, a PID and a WM_CLASS.
+func (wm *fakeWM) newWindow(title string, pid uint32, class string) x11.Window {
+	wm.t.Helper()
+	w := wm.x.createWindow()
+	wm.setTitle(w, title)
+	wm.change(w, wm.atoms["_NET_WM_PID"], x11.AtomCardinal, 32, uint32Value(pid))
+	wm.change(w, x11.AtomWMClass, x11.AtomString, 8, []byte(strings.ToLower(class)+"\x00"+class+"\x00"))
+	wm.sync()
+	return w
+}
+
+func (wm *fakeWM) setTitle(w x11.Window, title string) {
+	wm.t.Helper()
+	wm.change(w, wm.atoms["_NET_WM_NAME"], wm.atoms["UTF8_STRING"], 8, []byte(title))
+	wm.sync()
+}
+
+func (wm *fakeWM) activate(w x11.Window) {
+	wm.t.Helper()
+	wm.change(wm.x.root, wm.atoms["_NET_ACTIVE_WINDOW"], x11.AtomWindow, 32, uint32Value(uint32(w)))
+	wm.sync()
+}
+
+func (wm *fakeWM) change(w x11.Window, prop, typ x11.Atom, format byte, value []byte) {
+	wm.t.Helper()
+	wm.x.changeProperty(w, prop, typ, format, value)
+}
+
+// sync waits for the server to process every request sent so far, so that
+// other clients see their effects.
+func (wm *fakeWM) sync() {
+	wm.t.Helper()
+	wm.x.sync()
+}
+
+func TestX11ActiveWindow(t *testing.T) {
+	display := startXvfb(t)
+	wm := newFakeWM(t, display)
+
+	source, err := NewX11Source(display)
+	if err != nil {
+		t.Fatalf("NewX11Source: %v", err)
+	}
+	defer source.Close()
+
+	if _, err := source.ActiveWindow(); err == nil {
+		t.Error("ActiveWindow succeeded with no active window")
+	}
+
+	pid := uint32(os.Getpid())
+	editor := wm.newWindow("main.go – Editor ✓", pid, "Editor")
+	wm.activate(editor)
+
+	got, err := source.ActiveWindow()
+	if err != nil {
+		t.Fatalf("ActiveWindow: %v", err)
+	}
+	want := Window{
+		Title:   "main.go – Editor ✓",
+		Handle:  uintptr(editor),
+		Process: processName(pid),
+		PID:     pid,
+		Class:   "Editor",
+	}
+	got.Time = time.Time{}
+	if got != want {
+		t.Errorf("ActiveWindow = %+v, want %+v", got, want)
+	}
+	if got.Process == "" {
+		t.Error("process name of the test binary is empty")
+	}
+
+	// Windows without _NET_WM_NAME fall back to WM_NAME
+	legacy := wm.x.createWindow()
+	wm.change(legacy, x11.AtomWMName, x11.AtomString, 8, []byte("xterm"))
+	wm.activate(legacy)
+	if got, err := source.ActiveWindow(); err != nil || got.Title != "xterm" || got.PID != 0 {
+		t.Errorf("ActiveWindow = %+v, %v, want title xterm and no PID", got, err)
+	}
+}
+
+func TestX11SourceNoDisplay(t *testing.T) {
+	t.Setenv("DISPLAY", "")
+	if _, err := NewX11Source(""); err == nil {
+		t.Error("NewX11Source succeeded without a display")
+	}
+	if _, err := NewX11Source(fmt.Sprintf(":%d", 4000+os.Getpid()%1000)); err == nil {
+		t.Error("NewX11Source succeeded with a display that does not exist")
+	}
+}
+
+func TestX11Events(t *testing.T) {
+	display := startXvfb(t)
+	wm := newFakeWM(t, display)
+	pid := uint32(os.Getpid())
+	editor := wm.newWindow("main.go", pid, "Editor")
+	browser := wm.newWindow("News", pid, "Browser")
+	wm.activate(editor)
+
+	source, err := NewX11Source(display)
+	if err != nil {
+		t.Fatalf("NewX11Source: %v", err)
+	}
+	defer source.Close()
+	events, err := source.Events()
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+
+	if win := nextWindow(t, events); win.Title != "main.go" || win.Class != "Editor" {
+		t.Fatalf("first event = %+v, want the active editor", win)
+	}
+
+	wm.setTitle(editor, "util.go")
+	if win := nextWindow(t, events); win.Title != "util.go" {
+		t.Errorf("after a title change got %+v, want util.go", win)
+	}
+
+	wm.activate(browser)
+	if win := nextWindow(t, events); win.Title != "News" || win.Handle != uintptr(browser) {
+		t.Errorf("after activating the browser got %+v, want it", win)
+	}
+
+	// The editor is no longer watched
+	wm.setTitle(editor, "other.go")
+	wm.setTitle(browser, "Weather")
+	if win := nextWindow(t, events); win.Title != "Weather" {
+		t.Errorf("after title changes got %+v, want only the browser's", win)
+	}
+
+	// Pushed and polled windows agree, so both paths record the same
+	// sessions
+	polled, err := source.ActiveWindow()
+	if err != nil {
+		t.Fatalf("ActiveWindow: %v", err)
+	}
+	polled.Time = time.Time{}
+	wm.setTitle(browser, "Weather")
+	if pushed := nextWindow(t, events); pushed != polled {
+		t.Errorf("pushed %+v, polled %+v", pushed, polled)
+	}
+}
+
+// A consumer that stops reading, like a stopped WindowMonitor, must not
+// stall the reader: the newest window stays available and Close ends it.
+func TestX11UnreadEvents(t *testing.T) {
+	display := startXvfb(t)
+	wm := newFakeWM(t, display)
+	editor := wm.newWindow("title 0", uint32(os.Getpid()), "Editor")
+	wm.activate(editor)
+
+	source, err := NewX11Source(display)
+	if err != nil {
+		t.Fatalf("NewX11Source: %v", err)
+	}
+	events, err := source.Events()
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+
+	last := fmt.Sprintf("title %d", 3*eventBuffer)
+	for i := 1; i <= 3*eventBuffer; i++ {
+		wm.setTitle(editor, fmt.Sprintf("title %d", i))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(events) < cap(events) {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d events pending", len(events))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// The reader carried on past the full buffer, dropping older windows
+	for {
+		var win Window
+		for len(events) > 0 {
+			win = <-events
+		}
+		if win.Title == last {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%q was never delivered", last)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	source.Close()
+	select {
+	case <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event channel not closed after Close")
+	}
+}
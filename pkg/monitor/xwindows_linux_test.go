@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/windowmonitor/pkg/x11"
+)
+
+// xWindows is a bare X11 connection that creates windows and sets their
+// properties, which the read-only client in package x11 cannot do. It
+// speaks just enough of the core protocol for a fake window manager.
+type xWindows struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	seq  uint16
+	root x11.Window
+	// idBase and idMask describe the resource IDs this client may use, and
+	// lastID counts the ones allocated
+	idBase, idMask, lastID uint32
+}
+
+const (
+	xCreateWindow   = 1
+	xChangeProperty = 18
+	xGetInputFocus  = 43
+
+	xInputOnly = 2
+)
+
+var xOrder = binary.LittleEndian
+
+// dialXWindows connects to display, such as ":1", over its Unix socket
+// without authentication, as a private Xvfb allows.
+func dialXWindows(t *testing.T, display string) *xWindows {
+	t.Helper()
+	number := strings.TrimPrefix(display, ":")
+	conn, err := net.Dial("unix", "/tmp/.X11-unix/X"+number)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", display, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	x := &xWindows{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	setup := make([]byte, 12)
+	setup[0] = 'l'
+	xOrder.PutUint16(setup[2:], 11)
+	if _, err := conn.Write(setup); err != nil {
+		t.Fatalf("X11 setup failed: %v", err)
+	}
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(x.r, head); err != nil {
+		t.Fatalf("X11 setup failed: %v", err)
+	}
+	body := make([]byte, int(xOrder.Uint16(head[6:]))*4)
+	if _, err := io.ReadFull(x.r, body); err != nil {
+		t.Fatalf("X11 setup failed: %v", err)
+	}
+	if head[0] != 1 || len(body) < 32 {
+		t.Fatalf("X11 connection refused: %q", body)
+	}
+	x.idBase = xOrder.Uint32(body[4:])
+	x.idMask = xOrder.Uint32(body[8:])
+	vendorLen := int(xOrder.Uint16(body[16:]))
+	numFormats := int(body[21])
+	off := 32 + vendorLen + xPad(vendorLen) + 8*numFormats
+	if len(body) < off+4 {
+		t.Fatal("X11 setup reply has no screens")
+	}
+	x.root = x11.Window(xOrder.Uint32(body[off:]))
+	return x
+}
+
+func xPad(n int) int {
+	return (4 - n%4) % 4
+}
+
+func (x *xWindows) send(req []byte) {
+	x.t.Helper()
+	x.seq++
+	if _, err := x.conn.Write(req); err != nil {
+		x.t.Fatalf("X11 write failed: %v", err)
+	}
+}
+
+// newID allocates a resource ID for this connection.
+func (x *xWindows) newID() uint32 {
+	x.t.Helper()
+	x.lastID++
+	shift := bits.TrailingZeros32(x.idMask)
+	if x.idMask == 0 || x.lastID<<shift&^x.idMask != 0 {
+		x.t.Fatal("out of X11 resource IDs")
+	}
+	return x.idBase | x.lastID<<shift
+}
+
+// createWindow creates an unmapped input-only child of the root window. It
+// is never drawn, but can carry properties like any other window.
+func (x *xWindows) createWindow() x11.Window {
+	x.t.Helper()
+	id := x.newID()
+	req := make([]byte, 32)
+	req[0] = xCreateWindow
+	xOrder.PutUint16(req[2:], 8)
+	xOrder.PutUint32(req[4:], id)
+	xOrder.PutUint32(req[8:], uint32(x.root))
+	xOrder.PutUint16(req[16:], 1) // width
+	xOrder.PutUint16(req[18:], 1) // height
+	xOrder.PutUint16(req[22:], xInputOnly)
+	x.send(req)
+	return x11.Window(id)
+}
+
+// changeProperty replaces property prop on window w with value, which holds
+// items of format bits each.
+func (x *xWindows) changeProperty(w x11.Window, prop, typ x11.Atom, format byte, value []byte) {
+	x.t.Helper()
+	n := len(value)
+	req := make([]byte, 24, 24+n+xPad(n))
+	req[0] = xChangeProperty
+	xOrder.PutUint16(req[2:], uint16((24+n+xPad(n))/4))
+	xOrder.PutUint32(req[4:], uint32(w))
+	xOrder.PutUint32(req[8:], uint32(prop))
+	xOrder.PutUint32(req[12:], uint32(typ))
+	req[16] = format
+	xOrder.PutUint32(req[20:], uint32(n*8/int(format)))
+	req = append(req, value...)
+	req = append(req, make([]byte, xPad(n))...)
+	x.send(req)
+}
+
+// sync waits until the server has processed every request sent so far,
+// failing the test if any of them caused an error.
+func (x *xWindows) sync() {
+	x.t.Helper()
+	req := make([]byte, 4)
+	req[0] = xGetInputFocus
+	xOrder.PutUint16(req[2:], 1)
+	x.send(req)
+	for {
+		p := make([]byte, 32)
+		if _, err := io.ReadFull(x.r, p); err != nil {
+			x.t.Fatalf("X11 read failed: %v", err)
+		}
+		switch p[0] {
+		case 0:
+			x.t.Fatalf("X11 error %d for request %d", p[1], p[10])
+		case 1:
+			if extra := int(xOrder.Uint32(p[4:])) * 4; extra > 0 {
+				if _, err := io.CopyN(io.Discard, x.r, int64(extra)); err != nil {
+					x.t.Fatalf("X11 read failed: %v", err)
+				}
+			}
+			if xOrder.Uint16(p[2:]) == x.seq {
+				return
+			}
+		}
+		// Events are of no interest
+	}
+}
+
+// uint32Value encodes v as a format 32 property value.
+func uint32Value(v ...uint32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, n := range v {
+		xOrder.PutUint32(b[4*i:], n)
+	}
+	return b
+}
@@ -0,0 +1,93 @@
+package notification
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/windowmonitor/pkg/analytics"
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// DesktopNotifier handles native desktop notifications
+type DesktopNotifier struct {
+	db           storage.Storage
+	productivity *analytics.Productivity
+	lastWindow   string
+	lastDuration time.Duration
+}
+
+// NewDesktopNotifier creates a new notifier for the current platform
+func NewDesktopNotifier(db storage.Storage) *DesktopNotifier {
+	return &DesktopNotifier{db: db}
+}
+
+// SetProductivity adds the day's productivity score to the summary
+func (dn *DesktopNotifier) SetProductivity(productivity *analytics.Productivity) {
+	dn.productivity = productivity
+}
+
+// ShowWindowSwitchNotification shows a notification when switching between windows
+func (dn *DesktopNotifier) ShowWindowSwitchNotification(windowTitle string, duration time.Duration) error {
+	// Only show notification if the duration is significant (more than 5 seconds)
+	if duration.Seconds() < 5 {
+		return nil
+	}
+
+	// Format the notification message
+	message := fmt.Sprintf("You spent %s on %s", formatDuration(duration), windowTitle)
+
+	// Show the notification using the platform API
+	return dn.showNotification("Window Monitor", message)
+}
+
+// ShowSummaryNotification shows a summary notification when the application stops
+func (dn *DesktopNotifier) ShowSummaryNotification() error {
+	stats, err := dn.db.GetDailyStats()
+	if err != nil {
+		return fmt.Errorf("failed to get daily stats: %v", err)
+	}
+
+	if len(stats) == 0 {
+		return nil
+	}
+
+	// Find the most used window
+	var mostUsedWindow string
+	var longestDuration time.Duration
+
+	for _, stat := range stats {
+		if stat.Duration > longestDuration {
+			longestDuration = stat.Duration
+			mostUsedWindow = stat.Title
+		}
+	}
+
+	// Format the notification message
+	today := dn.db.Day().Start(time.Now())
+	message := fmt.Sprintf("Summary for %s: Most used window was %s (%s)",
+		today.Format("Mon 2 Jan"), mostUsedWindow, formatDuration(longestDuration))
+	if dn.productivity != nil {
+		trend, err := dn.productivity.Trend(time.Now(), 7)
+		if err != nil {
+			return fmt.Errorf("failed to get productivity score: %v", err)
+		}
+		message += fmt.Sprintf(". Productivity score %s", trend.Describe())
+	}
+
+	// Show the notification using the platform API
+	return dn.showNotification("Window Monitor Summary", message)
+}
+
+func formatDuration(d time.Duration) string {
+	if d.Hours() >= 1 {
+		hours := int(d.Hours())
+		minutes := int(d.Minutes()) % 60
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	} else if d.Minutes() >= 1 {
+		minutes := int(d.Minutes())
+		seconds := int(d.Seconds()) % 60
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	} else {
+		return fmt.Sprintf("%.0fs", d.Seconds())
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package notification
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// showNotification displays a notification through notify-send, which talks
+// to whatever org.freedesktop.Notifications daemon the session runs
+func (dn *DesktopNotifier) showNotification(title, message string) error {
+	// Print to console for logging purposes
+	fmt.Printf("[NOTIFICATION] %s: %s\n", title, message)
+
+	if err := exec.Command("notify-send", "--app-name=Window Monitor", "--expire-time=5000", title, message).Run(); err != nil {
+		return fmt.Errorf("failed to show notification: %v", err)
+	}
+	return nil
+}
@@ -9,11 +9,13 @@ import (
 )
 
 type Notifier struct {
-	db     *storage.Storage
+	db     storage.Storage
 	fcmKey string
+	// lastSummary is the start of the day the last summary was sent for
+	lastSummary time.Time
 }
 
-func NewNotifier(db *storage.Storage) *Notifier {
+func NewNotifier(db storage.Storage) *Notifier {
 	return &Notifier{
 		db:     db,
 		fcmKey: os.Getenv("FCM_SERVER_KEY"),
@@ -30,12 +32,18 @@ func (n *Notifier) CheckAndNotify() error {
 		return fmt.Errorf("FCM device token not configured")
 	}
 
-	currentHour := time.Now().Hour()
-
-	if currentHour == 21 {
-		return n.SendDailySummary(deviceToken)
+	// The summary goes out once per day, at 21:00 in the configured time
+	// zone
+	day := n.db.Day()
+	now := time.Now()
+	today := day.Start(now)
+	if now.In(today.Location()).Hour() != 21 || today.Equal(n.lastSummary) {
+		return nil
 	}
-
+	if err := n.SendDailySummary(deviceToken); err != nil {
+		return err
+	}
+	n.lastSummary = today
 	return nil
 }
 
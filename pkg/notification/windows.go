@@ -1,3 +1,5 @@
+//go:build windows
+
 package notification
 
 import (
@@ -5,7 +7,6 @@ import (
 	"time"
 	"unsafe"
 
-	"github.com/windowmonitor/pkg/storage"
 	"golang.org/x/sys/windows"
 )
 
@@ -23,6 +24,11 @@ const (
 	WM_TRAYICON = WM_APP + 1
 )
 
+var (
+	shell32         = windows.NewLazyDLL("shell32.dll")
+	shellNotifyIcon = shell32.NewProc("Shell_NotifyIconW")
+)
+
 // NOTIFYICONDATA structure for Windows API
 type NOTIFYICONDATA struct {
 	CbSize           uint32
@@ -41,73 +47,8 @@ type NOTIFYICONDATA struct {
 	GuidItem         windows.GUID
 }
 
-// WindowsNotifier handles Windows native notifications
-type WindowsNotifier struct {
-	db              *storage.Storage
-	shell32         *windows.LazyDLL
-	shellNotifyIcon *windows.LazyProc
-	lastWindow      string
-	lastDuration    time.Duration
-}
-
-// NewWindowsNotifier creates a new Windows notifier
-func NewWindowsNotifier(db *storage.Storage) *WindowsNotifier {
-	shell32 := windows.NewLazyDLL("shell32.dll")
-	shellNotifyIcon := shell32.NewProc("Shell_NotifyIconW")
-
-	return &WindowsNotifier{
-		db:              db,
-		shell32:         shell32,
-		shellNotifyIcon: shellNotifyIcon,
-	}
-}
-
-// ShowWindowSwitchNotification shows a notification when switching between windows
-func (wn *WindowsNotifier) ShowWindowSwitchNotification(windowTitle string, duration time.Duration) error {
-	// Only show notification if the duration is significant (more than 5 seconds)
-	if duration.Seconds() < 5 {
-		return nil
-	}
-
-	// Format the notification message
-	message := fmt.Sprintf("You spent %s on %s", formatDuration(duration), windowTitle)
-
-	// Show the notification using Windows API
-	return wn.showNotification("Window Monitor", message)
-}
-
-// ShowSummaryNotification shows a summary notification when the application stops
-func (wn *WindowsNotifier) ShowSummaryNotification() error {
-	stats, err := wn.db.GetDailyStats()
-	if err != nil {
-		return fmt.Errorf("failed to get daily stats: %v", err)
-	}
-
-	if len(stats) == 0 {
-		return nil
-	}
-
-	// Find the most used window
-	var mostUsedWindow string
-	var longestDuration time.Duration
-
-	for _, stat := range stats {
-		if stat.Duration > longestDuration {
-			longestDuration = stat.Duration
-			mostUsedWindow = stat.Title
-		}
-	}
-
-	// Format the notification message
-	message := fmt.Sprintf("Today's summary: Most used window was %s (%s)",
-		mostUsedWindow, formatDuration(longestDuration))
-
-	// Show the notification using Windows API
-	return wn.showNotification("Window Monitor Summary", message)
-}
-
 // showNotification displays a Windows notification
-func (wn *WindowsNotifier) showNotification(title, message string) error {
+func (dn *DesktopNotifier) showNotification(title, message string) error {
 	// Print to console for logging purposes
 	fmt.Printf("[NOTIFICATION] %s: %s\n", title, message)
 
@@ -136,7 +77,7 @@ func (wn *WindowsNotifier) showNotification(title, message string) error {
 	copy(nid.SzInfo[:], messageUTF16)
 
 	// Call the Windows API
-	ret, _, _ := wn.shellNotifyIcon.Call(
+	ret, _, _ := shellNotifyIcon.Call(
 		uintptr(NIM_ADD),
 		uintptr(unsafe.Pointer(&nid)),
 	)
@@ -149,7 +90,7 @@ func (wn *WindowsNotifier) showNotification(title, message string) error {
 	// Remove the notification after a short delay
 	go func() {
 		time.Sleep(5 * time.Second)
-		wn.shellNotifyIcon.Call(
+		shellNotifyIcon.Call(
 			uintptr(NIM_DELETE),
 			uintptr(unsafe.Pointer(&nid)),
 		)
@@ -157,17 +98,3 @@ func (wn *WindowsNotifier) showNotification(title, message string) error {
 
 	return nil
 }
-
-func formatDuration(d time.Duration) string {
-	if d.Hours() >= 1 {
-		hours := int(d.Hours())
-		minutes := int(d.Minutes()) % 60
-		return fmt.Sprintf("%dh %dm", hours, minutes)
-	} else if d.Minutes() >= 1 {
-		minutes := int(d.Minutes())
-		seconds := int(d.Seconds()) % 60
-		return fmt.Sprintf("%dm %ds", minutes, seconds)
-	} else {
-		return fmt.Sprintf("%.0fs", d.Seconds())
-	}
-}
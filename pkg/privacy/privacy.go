@@ -0,0 +1,165 @@
+// Package privacy rewrites or drops window sessions according to rules
+// from a file, before they are stored or shown anywhere.
+package privacy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/windowmonitor/pkg/rulesfile"
+	"github.com/windowmonitor/pkg/storage"
+)
+
+// Action is what a rule does to a matching session.
+type Action string
+
+const (
+	// Drop discards the session; nothing about it is stored.
+	Drop Action = "drop"
+	// AppName replaces the title with the application name.
+	AppName Action = "app_name"
+	// Hash replaces the title with a hash of it, so that time spent in the
+	// same window still adds up.
+	Hash Action = "hash"
+	// Redact replaces every match of Pattern in the title with
+	// Replacement and goes on with the next rule.
+	Redact Action = "redact"
+)
+
+// Rule matches sessions by application name and title, both regular
+// expressions that match anywhere unless anchored. An empty matcher matches
+// everything.
+type Rule struct {
+	App         string `json:"app,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Action      Action `json:"action"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+
+	app, title, pattern *regexp.Regexp
+}
+
+// Rules are applied in order. Drop, AppName and Hash end processing for a
+// session; Redact rules accumulate.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Parse reads and compiles rules in their JSON form.
+func Parse(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse privacy rules: %v", err)
+	}
+	for i := range rules.Rules {
+		if err := rules.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("privacy rule %d: %v", i+1, err)
+		}
+	}
+	return &rules, nil
+}
+
+func (r *Rule) compile() error {
+	var err error
+	if r.app, err = compile(r.App); err != nil {
+		return fmt.Errorf("invalid app pattern: %v", err)
+	}
+	if r.title, err = compile(r.Title); err != nil {
+		return fmt.Errorf("invalid title pattern: %v", err)
+	}
+	switch r.Action {
+	case Drop, AppName, Hash:
+	case Redact:
+		if r.Pattern == "" {
+			return fmt.Errorf("redact needs a pattern")
+		}
+		if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid redact pattern: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	return nil
+}
+
+func compile(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+func (r *Rule) matches(stat storage.WindowStats) bool {
+	if r.app != nil && !r.app.MatchString(stat.AppName()) {
+		return false
+	}
+	return r.title == nil || r.title.MatchString(stat.Title)
+}
+
+// Apply runs the rules over a session. It reports false if the session
+// must be dropped.
+func (rules *Rules) Apply(stat storage.WindowStats) (storage.WindowStats, bool) {
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if !rule.matches(stat) {
+			continue
+		}
+		switch rule.Action {
+		case Drop:
+			return stat, false
+		case AppName:
+			stat.Title = stat.AppName()
+			return stat, true
+		case Hash:
+			stat.Title = hashTitle(stat.Title)
+			return stat, true
+		case Redact:
+			stat.Title = rule.pattern.ReplaceAllString(stat.Title, rule.Replacement)
+		}
+	}
+	return stat, true
+}
+
+// hashTitle hides a title while keeping equal titles equal. Short titles
+// can still be guessed by hashing candidates.
+func hashTitle(title string) string {
+	sum := sha256.Sum256([]byte(title))
+	return "#" + hex.EncodeToString(sum[:6])
+}
+
+// Policy holds the rules from a file and reloads them when it changes.
+type Policy struct {
+	file *rulesfile.File[*Rules]
+}
+
+// Load reads the rules file at path. A missing file means no rules.
+func Load(path string) (*Policy, error) {
+	file, err := rulesfile.Load(path, "privacy rules", Parse, &Rules{})
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{file: file}, nil
+}
+
+// Reload re-reads the rules file. The current rules stay in force if it
+// cannot be read or parsed.
+func (p *Policy) Reload() error {
+	return p.file.Reload()
+}
+
+// Watch reloads the rules whenever the file's modification time changes,
+// checking every interval, and calls changed after each successful reload.
+// It does not return.
+func (p *Policy) Watch(interval time.Duration, changed func()) {
+	p.file.Watch(interval, changed)
+}
+
+// Apply runs the current rules over a session. It reports false if the
+// session must be dropped.
+func (p *Policy) Apply(stat storage.WindowStats) (storage.WindowStats, bool) {
+	return p.file.Rules().Apply(stat)
+}
@@ -0,0 +1,120 @@
+package privacy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/windowmonitor/pkg/storage"
+)
+
+func parse(t *testing.T, data string) *Rules {
+	t.Helper()
+	rules, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return rules
+}
+
+func TestApply(t *testing.T) {
+	rules := parse(t, `{"rules": [
+		{"app": "^keepass\\.exe$", "action": "drop"},
+		{"title": "(?i)private browsing", "action": "drop"},
+		{"app": "^outlook\\.exe$", "action": "app_name"},
+		{"title": "\\.pdf$", "action": "redact", "pattern": "\\d{6,}", "replacement": "######"},
+		{"title": "^Bank", "action": "hash"},
+		{"title": "@", "action": "redact", "pattern": "[\\w.]+@[\\w.]+", "replacement": "<email>"}
+	]}`)
+
+	tests := []struct {
+		name    string
+		title   string
+		process string
+		want    string
+		dropped bool
+	}{
+		{name: "no rule matches", title: "Editor", process: "code.exe", want: "Editor"},
+		{name: "drop by app", title: "Passwords", process: "keepass.exe", dropped: true},
+		{name: "drop by title", title: "New Private Browsing window", process: "firefox.exe", dropped: true},
+		{name: "app name", title: "Re: salary review", process: "outlook.exe", want: "outlook.exe"},
+		{name: "hash", title: "Bank of Example", process: "firefox.exe", want: hashTitle("Bank of Example")},
+		{name: "redact", title: "mail from a.b@example.com", process: "firefox.exe", want: "mail from <email>"},
+		// Redactions accumulate and later rules see the redacted title
+		{name: "redact twice", title: "Invoice 1234567 for a@example.com.pdf", process: "reader.exe", want: "Invoice ###### for <email>"},
+		{name: "redact then hash", title: "Bank statement 1234567.pdf", process: "reader.exe", want: hashTitle("Bank statement ######.pdf")},
+		// The first rule that ends processing wins
+		{name: "drop before app name", title: "Private Browsing", process: "outlook.exe", dropped: true},
+		{name: "app name before redact", title: "report.pdf from a@example.com", process: "outlook.exe", want: "outlook.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rules.Apply(storage.WindowStats{Title: tt.title, Process: tt.process})
+			if ok == tt.dropped {
+				t.Fatalf("Apply(%q) kept = %v, want %v", tt.title, ok, !tt.dropped)
+			}
+			if ok && got.Title != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.title, got.Title, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashKeepsEqualTitlesEqual(t *testing.T) {
+	a, b := hashTitle("Bank of Example"), hashTitle("Bank of Example")
+	if a != b || a == hashTitle("Bank of Elsewhere") || a == "Bank of Example" {
+		t.Errorf("hashes %q, %q", a, b)
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{"not JSON", `{"rules": [`},
+		{"unknown action", `{"rules": [{"action": "hide"}]}`},
+		{"missing action", `{"rules": [{"title": "x"}]}`},
+		{"invalid app pattern", `{"rules": [{"app": "(", "action": "drop"}]}`},
+		{"invalid title pattern", `{"rules": [{"title": "[", "action": "drop"}]}`},
+		{"redact without pattern", `{"rules": [{"action": "redact"}]}`},
+		{"invalid redact pattern", `{"rules": [{"action": "redact", "pattern": "("}]}`},
+	} {
+		if _, err := Parse([]byte(tt.data)); err == nil {
+			t.Errorf("%s: Parse succeeded", tt.name)
+		}
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "privacy.json")
+	policy, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load without a file: %v", err)
+	}
+	stat := storage.WindowStats{Title: "Secret", Process: "app.exe"}
+	if _, ok := policy.Apply(stat); !ok {
+		t.Error("a missing file drops sessions")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rules": [{"title": "Secret", "action": "drop"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, ok := policy.Apply(stat); ok {
+		t.Error("reloaded rules are not applied")
+	}
+
+	// Invalid rules leave the previous ones in force
+	if err := os.WriteFile(path, []byte(`{"rules": [{"action": "hide"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Reload(); err == nil {
+		t.Error("Reload accepted invalid rules")
+	}
+	if _, ok := policy.Apply(stat); ok {
+		t.Error("invalid rules replaced the previous ones")
+	}
+}
@@ -0,0 +1,107 @@
+// Package rulesfile keeps rules read from a file in memory and reloads them
+// when the file changes, so that edits take effect without a restart.
+package rulesfile
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// File holds the rules parsed from a file.
+type File[T any] struct {
+	path string
+	// name describes the rules in messages, such as "privacy rules"
+	name  string
+	parse func([]byte) (T, error)
+	empty T
+
+	mu      sync.RWMutex
+	rules   T
+	modTime time.Time
+}
+
+// Load reads the rules file at path with parse. A missing file means the
+// empty rules; name describes the rules in errors and log messages.
+func Load[T any](path, name string, parse func([]byte) (T, error), empty T) (*File[T], error) {
+	f := &File[T]{path: path, name: name, parse: parse, empty: empty, rules: empty}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Rules returns the rules currently in force.
+func (f *File[T]) Rules() T {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.rules
+}
+
+// Reload re-reads the rules file. The current rules stay in force if it
+// cannot be read or parsed.
+func (f *File[T]) Reload() error {
+	rules := f.empty
+	var modTime time.Time
+	info, err := os.Stat(f.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("failed to read %s: %v", f.name, err)
+	default:
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", f.name, err)
+		}
+		if rules, err = f.parse(data); err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+	}
+
+	f.mu.Lock()
+	f.rules = rules
+	f.modTime = modTime
+	f.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the rules whenever the file's modification time changes,
+// checking every interval, and calls changed, if set, after each
+// successful reload. It does not return.
+func (f *File[T]) Watch(interval time.Duration, changed func()) {
+	for {
+		time.Sleep(interval)
+		if f.check() && changed != nil {
+			changed()
+		}
+	}
+}
+
+// check reloads the rules if the file's modification time changed, and
+// reports whether new rules were loaded.
+func (f *File[T]) check() bool {
+	var modTime time.Time
+	if info, err := os.Stat(f.path); err == nil {
+		modTime = info.ModTime()
+	}
+	f.mu.RLock()
+	same := modTime.Equal(f.modTime)
+	f.mu.RUnlock()
+	if same {
+		return false
+	}
+
+	if err := f.Reload(); err != nil {
+		log.Printf("Keeping previous %s: %v", f.name, err)
+		// Do not retry until the file changes again
+		f.mu.Lock()
+		f.modTime = modTime
+		f.mu.Unlock()
+		return false
+	}
+	log.Printf("Reloaded %s from %s", f.name, f.path)
+	return true
+}
@@ -0,0 +1,78 @@
+package rulesfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// parse accepts any text but "bad".
+func parse(data []byte) (string, error) {
+	if string(data) == "bad" {
+		return "", fmt.Errorf("bad rules")
+	}
+	return string(data), nil
+}
+
+// write replaces the file at path, moving its modification time on by
+// step so that the change is seen on coarse clocks.
+func write(t *testing.T, path, text string, step int) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 3, 4, 9, 0, step, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	f, err := Load(path, "test rules", parse, "none")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := f.Rules(); got != "none" {
+		t.Errorf("rules of a missing file = %q, want the empty rules", got)
+	}
+	if f.check() {
+		t.Error("reloaded a file that is still missing")
+	}
+
+	write(t, path, "first", 1)
+	if !f.check() || f.Rules() != "first" {
+		t.Errorf("after writing the file rules = %q", f.Rules())
+	}
+	if f.check() {
+		t.Error("reloaded an unchanged file")
+	}
+
+	// Errors keep the previous rules until the file changes again
+	write(t, path, "bad", 2)
+	if f.check() || f.Rules() != "first" {
+		t.Errorf("after a bad edit rules = %q, want the previous ones", f.Rules())
+	}
+	if err := f.Reload(); err == nil {
+		t.Error("Reload accepted bad rules")
+	}
+	if f.check() {
+		t.Error("retried an unchanged bad file")
+	}
+	write(t, path, "second", 3)
+	if !f.check() || f.Rules() != "second" {
+		t.Errorf("after fixing the file rules = %q", f.Rules())
+	}
+
+	os.Remove(path)
+	if !f.check() || f.Rules() != "none" {
+		t.Errorf("after removing the file rules = %q, want the empty rules", f.Rules())
+	}
+
+	write(t, path, "bad", 4)
+	if _, err := Load(path, "test rules", parse, "none"); err == nil {
+		t.Error("Load accepted bad rules")
+	}
+}
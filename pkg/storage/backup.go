@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backups are named after the time they were taken, so that sorting their
+// names sorts them by age.
+const (
+	backupPrefix     = "window_stats-"
+	backupTimeFormat = "20060102T150405"
+)
+
+// RotateBackups writes a backup of s into dir and deletes all but the
+// newest keep backups. It returns the path of the new backup.
+func RotateBackups(s Storage, dir string, keep int, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	ext := ".json"
+	if _, ok := s.(*SQLiteStorage); ok {
+		ext = ".db"
+	}
+	path := filepath.Join(dir, backupPrefix+now.Local().Format(backupTimeFormat)+ext)
+	if err := s.Backup(path); err != nil {
+		return "", err
+	}
+
+	backups, err := listBackups(dir)
+	if err != nil {
+		return path, err
+	}
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return path, fmt.Errorf("failed to remove old backup: %v", err)
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+// LatestBackup returns when the newest backup in dir was taken, or the
+// zero time if there is none.
+func LatestBackup(dir string) (time.Time, error) {
+	backups, err := listBackups(dir)
+	if err != nil || len(backups) == 0 {
+		return time.Time{}, err
+	}
+	name := strings.TrimPrefix(filepath.Base(backups[len(backups)-1]), backupPrefix)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	t, err := time.ParseInLocation(backupTimeFormat, name, time.Local)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return t, nil
+}
+
+// listBackups returns the backups in dir, oldest first.
+func listBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %v", err)
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && !strings.Contains(name, ".tmp") {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Day defines the reporting day: it begins at StartHour in Location, so
+// with a StartHour of 4 work done until 04:00 counts towards the previous
+// day. A nil Location means the local time zone.
+type Day struct {
+	StartHour int
+	Location  *time.Location
+}
+
+func (d Day) location() *time.Location {
+	if d.Location == nil {
+		return time.Local
+	}
+	return d.Location
+}
+
+// Start returns the start of the day containing t. Its calendar date names
+// the day.
+func (d Day) Start(t time.Time) time.Time {
+	t = t.In(d.location())
+	start := d.at(t.Year(), t.Month(), t.Day())
+	if start.After(t) {
+		start = d.at(t.Year(), t.Month(), t.Day()-1)
+	}
+	return start
+}
+
+// Next returns the start of the day after the one containing t.
+func (d Day) Next(t time.Time) time.Time {
+	start := d.Start(t)
+	return d.at(start.Year(), start.Month(), start.Day()+1)
+}
+
+// WeekStart returns the start of the Monday that begins the week
+// containing t.
+func (d Day) WeekStart(t time.Time) time.Time {
+	start := d.Start(t)
+	return d.at(start.Year(), start.Month(), start.Day()-(int(start.Weekday())+6)%7)
+}
+
+// NextWeek returns the start of the week after the one containing t.
+func (d Day) NextWeek(t time.Time) time.Time {
+	start := d.WeekStart(t)
+	return d.at(start.Year(), start.Month(), start.Day()+7)
+}
+
+// MonthStart returns the start of the first day of the month containing t.
+// The month is that of the day containing t.
+func (d Day) MonthStart(t time.Time) time.Time {
+	start := d.Start(t)
+	return d.at(start.Year(), start.Month(), 1)
+}
+
+// NextMonth returns the start of the month after the one containing t.
+func (d Day) NextMonth(t time.Time) time.Time {
+	start := d.MonthStart(t)
+	return d.at(start.Year(), start.Month()+1, 1)
+}
+
+// HourStart returns the start of the hour containing t in the day's time
+// zone. It works from the offset into the hour rather than through
+// time.Date, which is ambiguous when clocks go back.
+func (d Day) HourStart(t time.Time) time.Time {
+	t = t.In(d.location())
+	into := time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	return t.Add(-into)
+}
+
+// NextHour returns the start of the hour after the one containing t.
+func (d Day) NextHour(t time.Time) time.Time {
+	return d.HourStart(t).Add(time.Hour)
+}
+
+func (d Day) at(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, d.StartHour, 0, 0, 0, d.location())
+}
+
+// ParseTime reads a time written in RFC 3339 or as a date. A date stands
+// for the start of that day, or with end set for the start of the next
+// one, so that a range of dates includes its last day. An empty string is
+// the zero time.
+func (d Day) ParseTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", s, d.location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use a date like 2006-01-02 or RFC 3339", s)
+	}
+	start := d.at(date.Year(), date.Month(), date.Day())
+	if end {
+		return d.Next(start), nil
+	}
+	return start, nil
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeySource supplies the 32-byte key that encrypts the data file. The salt
+// is random per file and stored in its header; sources that hold a random
+// key rather than deriving one may ignore it.
+type KeySource interface {
+	// Method names the kind of key, such as "passphrase" or "keyring". It
+	// is recorded in the file header for error messages.
+	Method() string
+	Key(salt []byte) ([]byte, error)
+}
+
+// Passphrase derives the key from a passphrase with scrypt.
+type Passphrase string
+
+func (p Passphrase) Method() string {
+	return "passphrase"
+}
+
+func (p Passphrase) Key(salt []byte) ([]byte, error) {
+	if p == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	key, err := scrypt.Key([]byte(p), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	return key, nil
+}
+
+// StaticKey is a fixed key, such as one held in a keyring.
+type StaticKey []byte
+
+func (k StaticKey) Method() string {
+	return "keyring"
+}
+
+func (k StaticKey) Key(salt []byte) ([]byte, error) {
+	if len(k) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, not %d", len(k))
+	}
+	return k, nil
+}
+
+// ErrWrongKey is returned when the data file cannot be decrypted with the
+// configured key.
+var ErrWrongKey = errors.New("wrong passphrase or key")
+
+// checkText is encrypted into the header so a wrong key is detected before
+// any record is read.
+const checkText = "windowmonitor"
+
+// fileHeader is the first line of the data file.
+type fileHeader struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	Encryption *encryptionHeader `json:"encryption,omitempty"`
+}
+
+type encryptionHeader struct {
+	Cipher string `json:"cipher"`
+	Method string `json:"method"`
+	Salt   []byte `json:"salt"`
+	Check  []byte `json:"check"`
+}
+
+// newEncryption creates the header and cipher for a freshly encrypted
+// file.
+func newEncryption(keys KeySource) (*encryptionHeader, cipher.AEAD, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	aead, err := newAEAD(keys, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	check, err := seal(aead, []byte(checkText))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &encryptionHeader{
+		Cipher: "aes-256-gcm",
+		Method: keys.Method(),
+		Salt:   salt,
+		Check:  check,
+	}, aead, nil
+}
+
+// openEncryption returns the cipher for a file with header h.
+func openEncryption(keys KeySource, h *encryptionHeader) (cipher.AEAD, error) {
+	if h.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported storage cipher %q", h.Cipher)
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("storage file is encrypted with a %s key, but encryption is not configured", h.Method)
+	}
+	aead, err := newAEAD(keys, h.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if text, err := open(aead, h.Check); err != nil || string(text) != checkText {
+		return nil, fmt.Errorf("failed to decrypt storage file (%s): %w", h.Method, ErrWrongKey)
+	}
+	return aead, nil
+}
+
+func newAEAD(keys KeySource, salt []byte) (cipher.AEAD, error) {
+	key, err := keys.Key(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data under a random nonce, which is prepended.
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("record too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+// codec encodes the record lines of a log: JSON with a CRC-32 prefix, the
+// JSON alone in version 1 logs, or base64 of the encrypted JSON, which
+// GCM already authenticates.
+type codec struct {
+	checksummed bool
+	aead        cipher.AEAD
+}
+
+func (c codec) encode(stat WindowStats) ([]byte, error) {
+	data, err := json.Marshal(stat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %v", err)
+	}
+	if c.aead != nil {
+		sealed, err := seal(c.aead, data)
+		if err != nil {
+			return nil, err
+		}
+		line := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)), base64.StdEncoding.EncodedLen(len(sealed))+1)
+		base64.StdEncoding.Encode(line, sealed)
+		return append(line, '\n'), nil
+	}
+	line := fmt.Appendf(nil, "%08x\t", crc32.ChecksumIEEE(data))
+	line = append(line, data...)
+	return append(line, '\n'), nil
+}
+
+func (c codec) decode(line []byte) (WindowStats, error) {
+	var stat WindowStats
+	switch {
+	case c.aead != nil:
+		sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+		n, err := base64.StdEncoding.Decode(sealed, line)
+		if err != nil {
+			return stat, err
+		}
+		if line, err = open(c.aead, sealed[:n]); err != nil {
+			return stat, err
+		}
+	case c.checksummed:
+		sum, data, ok := bytes.Cut(line, []byte("\t"))
+		if !ok {
+			return stat, fmt.Errorf("missing checksum")
+		}
+		want, err := strconv.ParseUint(string(sum), 16, 32)
+		if err != nil || crc32.ChecksumIEEE(data) != uint32(want) {
+			return stat, fmt.Errorf("checksum mismatch")
+		}
+		line = data
+	}
+	err := json.Unmarshal(line, &stat)
+	return stat, err
+}
+
+// UsesKey reports whether the data file at path is encrypted with keys.
+// Only the header is read, so the file is left untouched.
+func UsesKey(path string, keys KeySource) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	first, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	var header fileHeader
+	if err := json.Unmarshal(first, &header); err != nil || header.Format != logFormat || header.Encryption == nil {
+		return false, nil
+	}
+	if keys == nil {
+		return false, nil
+	}
+	if _, err := openEncryption(keys, header.Encryption); err != nil {
+		if errors.Is(err, ErrWrongKey) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// rewritten reports whether the file at path can be decrypted with to but
+// not with from, as when an earlier run was interrupted after rewriting it.
+func rewritten(path string, from, to KeySource) bool {
+	if from == nil || to == nil {
+		return false
+	}
+	if ok, err := UsesKey(path, to); err != nil || !ok {
+		return false
+	}
+	ok, err := UsesKey(path, from)
+	return err == nil && !ok
+}
+
+// Reencrypt rewrites the data file at path, reading it with from and
+// writing it with to under a fresh salt. Either may be nil for plaintext.
+// A file already rewritten for to is left as it is, so an interrupted run
+// can be repeated.
+func Reencrypt(path string, from, to KeySource) error {
+	if rewritten(path, from, to) {
+		return nil
+	}
+	s := &FileStorage{
+		filePath: path,
+		data:     &windowData{Stats: []WindowStats{}},
+		keys:     from,
+	}
+	if _, err := s.load(); err != nil {
+		return err
+	}
+	s.keys = to
+	if err := s.setupWriter(nil); err != nil {
+		return err
+	}
+	return s.writeFile(path)
+}
+
+// ReencryptBackups rewrites the file backend backups in dir like
+// Reencrypt. It returns the number of backups rewritten.
+func ReencryptBackups(dir string, from, to KeySource) (int, error) {
+	backups, err := listBackups(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, path := range backups {
+		if filepath.Ext(path) != ".json" {
+			continue
+		}
+		if err := Reencrypt(path, from, to); err != nil {
+			return n, fmt.Errorf("failed to re-encrypt %s: %v", path, err)
+		}
+		n++
+	}
+	return n, nil
+}
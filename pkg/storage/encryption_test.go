@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	oldKey = StaticKey(bytes.Repeat([]byte{1}, 32))
+	newKey = StaticKey(bytes.Repeat([]byte{2}, 32))
+)
+
+func writeEncrypted(t *testing.T, path string, keys KeySource) {
+	t.Helper()
+	db, err := NewEncryptedFileStorage(path, keys)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStorage: %v", err)
+	}
+	saveAll(t, db, sessions(3))
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestUsesKey(t *testing.T) {
+	dir := t.TempDir()
+	encrypted := filepath.Join(dir, "encrypted.json")
+	writeEncrypted(t, encrypted, oldKey)
+	plain := filepath.Join(dir, "plain.json")
+	db := openFile(t, plain)
+	saveAll(t, db, sessions(3))
+	db.Close()
+	before, err := os.ReadFile(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path string
+		keys KeySource
+		want bool
+	}{
+		{encrypted, oldKey, true},
+		{encrypted, newKey, false},
+		{encrypted, nil, false},
+		{plain, oldKey, false},
+	} {
+		if got, err := UsesKey(tt.path, tt.keys); err != nil || got != tt.want {
+			t.Errorf("UsesKey(%s, %v) = %v, %v, want %v", filepath.Base(tt.path), tt.keys, got, err, tt.want)
+		}
+	}
+	if _, err := UsesKey(filepath.Join(dir, "missing.json"), oldKey); err == nil {
+		t.Error("UsesKey succeeded on a missing file")
+	}
+
+	// Only the header is read
+	after, err := os.ReadFile(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("UsesKey changed the file")
+	}
+	if files := corruptFiles(t, encrypted); len(files) != 0 {
+		t.Errorf("file was moved aside to %v", files)
+	}
+}
+
+func TestReencryptRepeated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	writeEncrypted(t, path, oldKey)
+
+	if err := Reencrypt(path, oldKey, newKey); err != nil {
+		t.Fatalf("Reencrypt: %v", err)
+	}
+	rewritten, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second run, as after an interruption, leaves the file alone
+	if err := Reencrypt(path, oldKey, newKey); err != nil {
+		t.Fatalf("repeated Reencrypt: %v", err)
+	}
+	again, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rewritten, again) {
+		t.Error("repeated Reencrypt rewrote the file")
+	}
+
+	db, err := NewEncryptedFileStorage(path, newKey)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStorage with the new key: %v", err)
+	}
+	checkSessions(t, stored(t, db), sessions(3))
+	db.Close()
+	again, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewriting with the same key still takes a fresh salt
+	if err := Reencrypt(path, newKey, newKey); err != nil {
+		t.Fatalf("Reencrypt with the same key: %v", err)
+	}
+	if salted, _ := os.ReadFile(path); bytes.Equal(salted, again) {
+		t.Error("Reencrypt with the same key left the file unchanged")
+	}
+}
+
+func TestReencryptDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stats.json")
+	backups := filepath.Join(dir, "backups")
+	db, err := NewEncryptedFileStorage(path, oldKey)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStorage: %v", err)
+	}
+	saveAll(t, db, sessions(3))
+	backup, err := RotateBackups(db, backups, 3, time.Date(2024, 3, 4, 9, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatalf("RotateBackups: %v", err)
+	}
+	db.Close()
+
+	// Without a key the encrypted data cannot be opened
+	if _, err := NewFileStorage(path); err == nil {
+		t.Fatal("NewFileStorage opened encrypted data without a key")
+	}
+
+	for i := 0; i < 2; i++ {
+		// The second run, as after an interruption, finds plaintext
+		if err := Reencrypt(path, oldKey, nil); err != nil {
+			t.Fatalf("Reencrypt run %d: %v", i+1, err)
+		}
+		if n, err := ReencryptBackups(backups, oldKey, nil); err != nil || n != 1 {
+			t.Fatalf("ReencryptBackups run %d = %d, %v", i+1, n, err)
+		}
+	}
+	checkSessions(t, reopen(t, path), sessions(3))
+	checkSessions(t, reopen(t, backup), sessions(3))
+	for _, p := range []string{path, backup} {
+		if encrypted, err := UsesKey(p, oldKey); err != nil || encrypted {
+			t.Errorf("%s is still encrypted: %v", filepath.Base(p), err)
+		}
+	}
+}
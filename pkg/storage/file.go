@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStorage keeps every session in memory and persists them to a
+// JSON-lines log file, optionally encrypted.
+type FileStorage struct {
+	filePath string
+	lock     *FileLock
+	mutex    sync.RWMutex
+	data     *windowData
+	log      *os.File
+	appended int
+	day      Day
+
+	keys    KeySource
+	codec   codec
+	header  string
+	rewrite bool
+}
+
+type windowData struct {
+	Stats []WindowStats `json:"stats"`
+}
+
+func NewFileStorage(filePath string) (*FileStorage, error) {
+	return NewEncryptedFileStorage(filePath, nil)
+}
+
+// NewEncryptedFileStorage opens the data file with records encrypted by a
+// key from keys. A plaintext file is encrypted as it is opened; a nil keys
+// leaves the file in plaintext.
+func NewEncryptedFileStorage(filePath string, keys KeySource) (*FileStorage, error) {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// Another process appending to or compacting the same file would
+	// undo this one's changes
+	lock, err := LockFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStorage{
+		filePath: filePath,
+		lock:     lock,
+		data:     &windowData{Stats: []WindowStats{}},
+		keys:     keys,
+	}
+	if err := s.open(); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStorage) open() error {
+	enc, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := s.setupWriter(enc); err != nil {
+		return err
+	}
+	if s.rewrite {
+		return s.compact()
+	}
+	return s.openLog()
+}
+
+// Close writes a compacted snapshot and closes the data file.
+func (s *FileStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.log == nil {
+		return nil
+	}
+	err := s.compact()
+	if s.log != nil {
+		s.log.Close()
+		s.log = nil
+	}
+	s.lock.Unlock()
+	return err
+}
+
+// Backup writes a snapshot of the data to path.
+func (s *FileStorage) Backup(path string) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.writeFile(path)
+}
+
+// SaveWindowStats records a finished session, split at day boundaries. A
+// zero Date is set to the current time and a zero Start to Date minus
+// Duration.
+func (s *FileStorage) SaveWindowStats(stat WindowStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, piece := range prepare(stat, s.day) {
+		s.data.Stats = append(s.data.Stats, piece)
+		if err := s.appendLog(piece); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sessions returns the sessions that overlap [from, to), unclipped.
+func (s *FileStorage) Sessions(from, to time.Time) ([]WindowStats, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var sessions []WindowStats
+	for _, stat := range s.data.Stats {
+		if stat.Start.Before(to) && stat.Date.After(from) {
+			sessions = append(sessions, stat)
+		}
+	}
+	return sessions, nil
+}
+
+// SetDay changes the definition of a day. It must be called before the
+// storage is used.
+func (s *FileStorage) SetDay(day Day) {
+	s.day = day
+}
+
+// Day returns the definition of a day.
+func (s *FileStorage) Day() Day {
+	return s.day
+}
+
+// Query aggregates active sessions as described by q.
+func (s *FileStorage) Query(q Query) ([]WindowStats, error) {
+	return runQuery(s, s.day, q)
+}
+
+// ApplyRetention rolls up and deletes old data according to r, and
+// rewrites the data file if anything changed.
+func (s *FileStorage) ApplyRetention(r Retention, now time.Time) (RetentionReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats, report := applyRetention(s.data.Stats, r, s.day, now)
+	if !report.Changed() {
+		return report, nil
+	}
+	s.data.Stats = stats
+	return report, s.compact()
+}
+
+// Forget deletes the sessions that sel matches, trimming those that only
+// partly fall into its time range, and rewrites the data file.
+func (s *FileStorage) Forget(sel Selector) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats, n := forget(s.data.Stats, sel)
+	if n == 0 {
+		return 0, nil
+	}
+	s.data.Stats = stats
+	return n, s.compact()
+}
+
+// Recategorize updates the categories and tags of all sessions, and
+// rewrites the data file if any changed.
+func (s *FileStorage) Recategorize(categorize Categorizer) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := recategorize(s.data.Stats, categorize)
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	return len(changed), s.compact()
+}
+
+// GetDailyStats returns today's usage grouped by window title.
+func (s *FileStorage) GetDailyStats(filters ...StatsFilter) ([]WindowStats, error) {
+	return s.Query(dailyQuery(s.day, GroupByTitle, filters))
+}
+
+// GetDailyAppStats returns today's usage grouped by application. Title
+// holds the application name in the results.
+func (s *FileStorage) GetDailyAppStats(filters ...StatsFilter) ([]WindowStats, error) {
+	return s.Query(dailyQuery(s.day, GroupByApp, filters))
+}
+
+// GetDailyCategoryStats returns today's usage grouped by category. Title
+// holds the category name in the results.
+func (s *FileStorage) GetDailyCategoryStats(filters ...StatsFilter) ([]WindowStats, error) {
+	return s.Query(dailyQuery(s.day, GroupByCategory, filters))
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Selector picks sessions to forget. Every field that is set must match,
+// and at least one must be set. Sessions that only partly overlap
+// [From, To) are trimmed to the part outside it; a zero From or To leaves
+// that end open.
+type Selector struct {
+	// Title matches the exact window title.
+	Title        string
+	TitlePattern *regexp.Regexp
+	// App matches the application name; rollups keep it as well.
+	App      string
+	From, To time.Time
+}
+
+// IsZero reports whether the selector has no criteria.
+func (sel Selector) IsZero() bool {
+	return sel.Title == "" && sel.TitlePattern == nil && sel.App == "" &&
+		sel.From.IsZero() && sel.To.IsZero()
+}
+
+func (sel Selector) String() string {
+	var parts []string
+	if sel.Title != "" {
+		parts = append(parts, fmt.Sprintf("title %q", sel.Title))
+	}
+	if sel.TitlePattern != nil {
+		parts = append(parts, fmt.Sprintf("titles matching %q", sel.TitlePattern))
+	}
+	if sel.App != "" {
+		parts = append(parts, fmt.Sprintf("app %q", sel.App))
+	}
+	if !sel.From.IsZero() {
+		parts = append(parts, "from "+sel.From.Format(time.RFC3339))
+	}
+	if !sel.To.IsZero() {
+		parts = append(parts, "until "+sel.To.Format(time.RFC3339))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (sel Selector) matches(stat WindowStats) bool {
+	if sel.Title != "" && stat.Title != sel.Title {
+		return false
+	}
+	if sel.TitlePattern != nil && !sel.TitlePattern.MatchString(stat.Title) {
+		return false
+	}
+	if sel.App != "" && stat.AppName() != sel.App {
+		return false
+	}
+	if !sel.From.IsZero() && !stat.Date.After(sel.From) {
+		return false
+	}
+	return sel.To.IsZero() || stat.Start.Before(sel.To)
+}
+
+// remainder returns what is left of a matching session once the selected
+// time range is cut out of it.
+func (sel Selector) remainder(stat WindowStats) []WindowStats {
+	var pieces []WindowStats
+	if !sel.From.IsZero() {
+		if piece, ok := clip(stat, stat.Start, sel.From); ok {
+			pieces = append(pieces, piece)
+		}
+	}
+	if !sel.To.IsZero() {
+		if piece, ok := clip(stat, sel.To, stat.Date); ok {
+			pieces = append(pieces, piece)
+		}
+	}
+	return pieces
+}
+
+// forget removes the sessions sel matches from stats, trimming partial
+// matches, and returns what is kept and how many sessions were affected.
+func forget(stats []WindowStats, sel Selector) ([]WindowStats, int) {
+	kept := stats[:0]
+	var trimmed []WindowStats
+	n := 0
+	for _, stat := range stats {
+		if !sel.matches(stat) {
+			kept = append(kept, stat)
+			continue
+		}
+		trimmed = append(trimmed, sel.remainder(stat)...)
+		n++
+	}
+	return append(kept, trimmed...), n
+}
+
+// ForgetReport describes what Eraser.Forget deleted.
+type ForgetReport struct {
+	// Sessions counts affected records in the live storage, including
+	// rollups.
+	Sessions int
+	// Backups counts backups that held matching records.
+	Backups int
+	// Leftovers are files that may still hold the data but could not be
+	// cleaned, such as damaged files moved aside. They should be deleted.
+	Leftovers []string
+}
+
+// Eraser deletes sessions from a storage and from the backups and other
+// data files in its directory, so they are gone everywhere.
+type Eraser struct {
+	Storage Storage
+	// Dir is the data directory and Keys the key for encrypted files.
+	Dir  string
+	Keys KeySource
+}
+
+// Forget deletes the sessions sel matches.
+func (e Eraser) Forget(sel Selector) (ForgetReport, error) {
+	var report ForgetReport
+	if sel.IsZero() {
+		return report, fmt.Errorf("nothing selected to forget")
+	}
+
+	n, err := e.Storage.Forget(sel)
+	if err != nil {
+		return report, err
+	}
+	report.Sessions = n
+
+	backups, err := listBackups(filepath.Join(e.Dir, "backups"))
+	if err != nil {
+		return report, err
+	}
+	migrated, _ := filepath.Glob(filepath.Join(e.Dir, jsonFile+".migrated"))
+	for _, path := range append(backups, migrated...) {
+		n, err := forgetInFile(path, sel, e.Keys)
+		if err != nil {
+			return report, fmt.Errorf("failed to forget sessions in %s: %v", path, err)
+		}
+		if n > 0 {
+			report.Backups++
+		}
+	}
+
+	report.Leftovers, _ = filepath.Glob(filepath.Join(e.Dir, "*.corrupt-*"))
+	return report, nil
+}
+
+// forgetInFile deletes sessions from a backup or other data file that is
+// not in use.
+func forgetInFile(path string, sel Selector, keys KeySource) (int, error) {
+	if filepath.Ext(path) == ".db" {
+		db, err := NewSQLiteStorage(path)
+		if err != nil {
+			return 0, err
+		}
+		n, err := db.Forget(sel)
+		if err == nil && n > 0 {
+			err = db.vacuum()
+		}
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+		os.Remove(path + "-wal")
+		os.Remove(path + "-shm")
+		return n, err
+	}
+
+	fs, err := NewEncryptedFileStorage(path, keys)
+	if err != nil {
+		return 0, err
+	}
+	n, err := fs.Forget(sel)
+	if closeErr := fs.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned when another process has the data file open.
+var ErrLocked = errors.New("the data file is in use by another process; quit Window Monitor first")
+
+// FileLock is an exclusive lock on a data file, held through a separate
+// lock file next to it so the data file itself can be replaced. The
+// operating system releases it if the process dies.
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile takes the lock on the data file at path, failing with ErrLocked
+// if another process holds it.
+func LockFile(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileLock{f: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	return l.f.Close()
+}
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The data file is a JSON-lines log: a JSON header line followed by one
+// record per line, each a WindowStats encoded by the file's codec. New
+// sessions are appended, and the whole file is periodically rewritten as a
+// snapshot through a temporary file and a rename, so a crash can at worst
+// lose a partially written last line. Version 1 logs had no checksums and
+// are still read.
+const (
+	logFormat   = "windowmonitor-log"
+	logHeader   = `{"format":"windowmonitor-log","version":2}` + "\n"
+	logHeaderV1 = `{"format":"windowmonitor-log","version":1}` + "\n"
+)
+
+// compactEvery is the number of appends after which the log is rewritten.
+const compactEvery = 1000
+
+// load reads the data file into memory and returns the encryption header
+// of the file, if it was encrypted. Files written before the log format,
+// which hold a single JSON document, are read as well. A damaged file is
+// moved aside and only the records that could be read are kept.
+func (s *FileStorage) load() (*encryptionHeader, error) {
+	data, err := os.ReadFile(s.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	// Anything but an unchanged log is rewritten once loaded
+	s.rewrite = true
+
+	var stats []WindowStats
+	var skipped int
+	var torn bool
+	first, body, _ := bytes.Cut(data, []byte("\n"))
+	var header fileHeader
+	if err := json.Unmarshal(first, &header); err == nil && header.Format == logFormat {
+		c := codec{checksummed: header.Version >= 2}
+		if header.Encryption != nil {
+			if c.aead, err = openEncryption(s.keys, header.Encryption); err != nil {
+				return nil, err
+			}
+		}
+		stats, skipped, torn = parseLog(body, c)
+		s.rewrite = torn || header.Version < 2 || (header.Encryption == nil) != (s.keys == nil)
+	} else {
+		var legacy windowData
+		if err := json.Unmarshal(data, &legacy); err == nil {
+			stats = legacy.Stats
+		} else {
+			// Neither format parses; the header itself may be damaged
+			stats, skipped = salvage(data)
+			if legacy := salvageLegacy(data); len(legacy) > len(stats) {
+				stats = legacy
+			}
+			if skipped == 0 {
+				skipped = 1
+			}
+		}
+	}
+
+	for i := range stats {
+		if stats[i].Start.IsZero() {
+			// Written before sessions recorded their start
+			stats[i].Start = stats[i].Date.Add(-stats[i].Duration)
+		}
+	}
+	s.data.Stats = stats
+
+	if skipped > 0 {
+		aside, err := moveAside(s.filePath)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Storage file %s was damaged: recovered %d sessions, skipped %d unreadable records; the original was moved to %s",
+			s.filePath, len(stats), skipped, aside)
+		s.rewrite = true
+	}
+	return header.Encryption, nil
+}
+
+// setupWriter chooses how records are written: encrypted with the keys of
+// the file that was loaded if enc is set, under a fresh salt if keys are
+// configured, and in plaintext otherwise.
+func (s *FileStorage) setupWriter(enc *encryptionHeader) error {
+	s.codec = codec{checksummed: true}
+	s.header = logHeader
+	if s.keys == nil {
+		return nil
+	}
+
+	var err error
+	if enc != nil {
+		s.codec.aead, err = openEncryption(s.keys, enc)
+	} else {
+		enc, s.codec.aead, err = newEncryption(s.keys)
+	}
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(fileHeader{Format: logFormat, Version: 2, Encryption: enc})
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage header: %v", err)
+	}
+	s.header = string(header) + "\n"
+	return nil
+}
+
+// parseLog reads the record lines of a log. It returns the readable
+// records, the number of damaged lines, and whether the only damage is an
+// unterminated last line, which is what a crash during an append leaves.
+func parseLog(body []byte, c codec) (stats []WindowStats, damaged int, torn bool) {
+	lines := bytes.Split(body, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		stat, err := c.decode(line)
+		if err != nil {
+			if i == len(lines)-1 {
+				torn = true
+				continue
+			}
+			damaged++
+			continue
+		}
+		stats = append(stats, stat)
+	}
+	return stats, damaged, torn
+}
+
+// salvage recovers what it can from a file whose header is unreadable by
+// trying every line as a plaintext log record. Encrypted records cannot be
+// read without the salt in the header.
+func salvage(data []byte) (stats []WindowStats, damaged int) {
+	codecs := []codec{{checksummed: true}, {}}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 || bytes.HasPrefix(line, []byte(`{"format"`)) {
+			continue
+		}
+		var stat WindowStats
+		err := fmt.Errorf("no codec")
+		for _, c := range codecs {
+			if stat, err = c.decode(line); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			damaged++
+			continue
+		}
+		stats = append(stats, stat)
+	}
+	return stats, damaged
+}
+
+// salvageLegacy reads the sessions of a single-document file up to the
+// first damaged one.
+func salvageLegacy(data []byte) []WindowStats {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for _, want := range []any{json.Delim('{'), "stats", json.Delim('[')} {
+		if tok, err := dec.Token(); err != nil || tok != want {
+			return nil
+		}
+	}
+	var stats []WindowStats
+	for dec.More() {
+		var stat WindowStats
+		if err := dec.Decode(&stat); err != nil {
+			break
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// moveAside renames a damaged file out of the way and returns its new
+// path.
+func moveAside(path string) (string, error) {
+	aside := path + ".corrupt-" + time.Now().Format("20060102T150405")
+	if err := os.Rename(path, aside); err != nil {
+		return "", fmt.Errorf("failed to move damaged storage file aside: %v", err)
+	}
+	return aside, nil
+}
+
+// openLog opens the data file for appending, creating it if necessary.
+func (s *FileStorage) openLog() error {
+	f, err := os.OpenFile(s.filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open storage file: %v", err)
+	}
+	// Files from earlier versions were readable by everyone
+	f.Chmod(0600)
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		if _, err := f.WriteString(s.header); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write storage header: %v", err)
+		}
+	}
+	s.log = f
+	return nil
+}
+
+// appendLog writes one session to the end of the log.
+func (s *FileStorage) appendLog(stat WindowStats) error {
+	if s.log == nil {
+		return fmt.Errorf("storage is closed")
+	}
+	line, err := s.codec.encode(stat)
+	if err != nil {
+		return err
+	}
+	if _, err := s.log.Write(line); err != nil {
+		return fmt.Errorf("failed to append to storage file: %v", err)
+	}
+	if err := s.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync storage file: %v", err)
+	}
+
+	s.appended++
+	if s.appended >= compactEvery {
+		return s.compact()
+	}
+	return nil
+}
+
+// writeSnapshot writes the whole log from memory to w.
+func (s *FileStorage) writeSnapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(s.header)
+	for _, stat := range s.data.Stats {
+		line, err := s.codec.encode(stat)
+		if err != nil {
+			return err
+		}
+		bw.Write(line)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	return nil
+}
+
+// writeFile writes a snapshot to path through a temporary file and a
+// rename, so path always holds a complete snapshot.
+func (s *FileStorage) writeFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := s.writeSnapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+	return nil
+}
+
+// compact rewrites the log from memory as a fresh snapshot.
+func (s *FileStorage) compact() error {
+	// The log is closed first because Windows cannot replace an open file
+	if s.log != nil {
+		s.log.Close()
+		s.log = nil
+	}
+	err := s.writeFile(s.filePath)
+	if err == nil {
+		s.appended = 0
+	}
+	if openErr := s.openLog(); err == nil {
+		err = openErr
+	}
+	return err
+}
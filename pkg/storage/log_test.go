@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var day0 = time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+
+// sessions returns n sessions of a minute each, one every hour from day0,
+// with every field set.
+func sessions(n int) []WindowStats {
+	var stats []WindowStats
+	for i := 0; i < n; i++ {
+		start := day0.Add(time.Duration(i) * time.Hour)
+		stats = append(stats, WindowStats{
+			Title:    fmt.Sprintf("Window %d", i),
+			Process:  "app.exe",
+			PID:      uint32(100 + i),
+			Class:    "AppWindow",
+			Duration: time.Minute,
+			Start:    start,
+			Date:     start.Add(time.Minute),
+			Category: "Work",
+			Tags:     []string{"tag"},
+		})
+	}
+	return stats
+}
+
+func saveAll(t *testing.T, db Storage, stats []WindowStats) {
+	t.Helper()
+	for _, stat := range stats {
+		if err := db.SaveWindowStats(stat); err != nil {
+			t.Fatalf("SaveWindowStats: %v", err)
+		}
+	}
+}
+
+// stored returns every session in db.
+func stored(t *testing.T, db Storage) []WindowStats {
+	t.Helper()
+	stats, err := db.Sessions(time.Time{}, time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	return stats
+}
+
+func checkSessions(t *testing.T, got, want []WindowStats) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d sessions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, _ := json.Marshal(got[i])
+		w, _ := json.Marshal(want[i])
+		if !bytes.Equal(g, w) {
+			t.Errorf("session %d = %s, want %s", i, g, w)
+		}
+	}
+}
+
+func openFile(t *testing.T, path string) *FileStorage {
+	t.Helper()
+	db, err := NewFileStorage(path)
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	return db
+}
+
+// reopen returns the sessions stored at path as a fresh FileStorage sees
+// them.
+func reopen(t *testing.T, path string) []WindowStats {
+	t.Helper()
+	// Only load the file: it may still be open, and locked, elsewhere
+	db := &FileStorage{filePath: path, data: &windowData{Stats: []WindowStats{}}}
+	if _, err := db.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return stored(t, db)
+}
+
+// logLines returns the lines of the log at path.
+func logLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// corruptFiles returns the damaged files moved aside next to path.
+func corruptFiles(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".corrupt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestLogRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	want := sessions(5)
+
+	db := openFile(t, path)
+	saveAll(t, db, want)
+	// Appends reach the file before Close
+	lines := logLines(t, path)
+	if lines[0]+"\n" != logHeader || len(lines) != 1+len(want) {
+		t.Fatalf("log after appends has %d lines starting %q", len(lines), lines[0])
+	}
+	for _, line := range lines[1:] {
+		if _, err := (codec{checksummed: true}).decode([]byte(line)); err != nil {
+			t.Errorf("record %q: %v", line, err)
+		}
+	}
+	// Read it back without closing, as after a crash
+	checkSessions(t, reopen(t, path), want)
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	reopened := openFile(t, path)
+	defer reopened.Close()
+	checkSessions(t, stored(t, reopened), want)
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("data file mode = %v, %v, want 0600", info.Mode(), err)
+	}
+	if files := corruptFiles(t, path); len(files) != 0 {
+		t.Errorf("undamaged log was moved aside to %v", files)
+	}
+}
+
+func TestLogCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	db := openFile(t, path)
+	defer db.Close()
+
+	want := sessions(compactEvery + 3)
+	saveAll(t, db, want)
+	if db.appended != 3 {
+		t.Errorf("%d appends since compaction, want 3", db.appended)
+	}
+	if lines := logLines(t, path); len(lines) != 1+len(want) {
+		t.Errorf("compacted log has %d lines, want %d", len(lines), 1+len(want))
+	}
+	checkSessions(t, reopen(t, path), want)
+
+	// No temporary snapshots are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("directory holds %d files, want only the log and its lock", len(entries))
+	}
+}
+
+func TestLogLegacyFormats(t *testing.T) {
+	want := sessions(3)
+	// Early files recorded no start
+	legacy := sessions(3)
+	for i := range legacy {
+		legacy[i].Start = time.Time{}
+	}
+	document, err := json.Marshal(windowData{Stats: legacy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := []byte(logHeaderV1)
+	for _, stat := range want {
+		line, err := json.Marshal(stat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v1 = append(append(v1, line...), '\n')
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"single JSON document", document},
+		{"version 1 log", v1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stats.json")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			db := openFile(t, path)
+			defer db.Close()
+			checkSessions(t, stored(t, db), want)
+
+			// The file is upgraded to the current format as it is opened
+			lines := logLines(t, path)
+			if lines[0]+"\n" != logHeader || len(lines) != 1+len(want) {
+				t.Errorf("upgraded log has %d lines starting %q", len(lines), lines[0])
+			}
+			if files := corruptFiles(t, path); len(files) != 0 {
+				t.Errorf("readable file was moved aside to %v", files)
+			}
+		})
+	}
+}
+
+func TestLogTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	want := sessions(4)
+	db := openFile(t, path)
+	saveAll(t, db, want)
+
+	// A crash in the middle of an append leaves part of a line
+	line, err := db.codec.encode(sessions(5)[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(line[:len(line)/2])
+	f.Close()
+	// The process dies, releasing the lock
+	db.log.Close()
+	db.lock.Unlock()
+
+	reopened := openFile(t, path)
+	checkSessions(t, stored(t, reopened), want)
+	if files := corruptFiles(t, path); len(files) != 0 {
+		t.Errorf("torn log was moved aside to %v", files)
+	}
+	// The torn line is dropped, and new records start on a line of their
+	// own
+	more := sessions(6)[5]
+	saveAll(t, reopened, []WindowStats{more})
+	reopened.Close()
+	checkSessions(t, reopen(t, path), append(want, more))
+	if lines := logLines(t, path); len(lines) != 1+len(want)+1 {
+		t.Errorf("log has %d lines, want %d", len(lines), 1+len(want)+1)
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	db := openFile(t, path)
+	saveAll(t, db, sessions(2))
+
+	// A second process, or a command, cannot open or rewrite the file
+	if _, err := NewFileStorage(path); err != ErrLocked {
+		t.Errorf("NewFileStorage while open = %v, want ErrLocked", err)
+	}
+	if _, err := LockFile(path); err != ErrLocked {
+		t.Errorf("LockFile while open = %v, want ErrLocked", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	lock, err := LockFile(path)
+	if err != nil {
+		t.Fatalf("LockFile after Close: %v", err)
+	}
+	if _, err := NewFileStorage(path); err != ErrLocked {
+		t.Errorf("NewFileStorage while locked = %v, want ErrLocked", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	reopened := openFile(t, path)
+	defer reopened.Close()
+	checkSessions(t, stored(t, reopened), sessions(2))
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backend names accepted by Open.
+const (
+	BackendSQLite = "sqlite"
+	BackendFile   = "file"
+)
+
+const (
+	sqliteFile = "window_stats.db"
+	jsonFile   = "window_stats.json"
+)
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// Open opens the storage backend in dir. Earlier versions wrote JSON into
+// window_stats.db; such a file is moved to window_stats.json, and the SQLite
+// backend imports it once and renames it to window_stats.json.migrated.
+// Sessions are split and grouped by day according to day. Non-nil keys
+// encrypt the data, which only the file backend supports.
+func Open(dir, backend string, day Day, keys KeySource) (Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+	dbPath := filepath.Join(dir, sqliteFile)
+	jsonPath := filepath.Join(dir, jsonFile)
+
+	if err := moveLegacyJSON(dbPath, jsonPath); err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case BackendFile:
+		fs, err := NewEncryptedFileStorage(jsonPath, keys)
+		if err != nil {
+			return nil, err
+		}
+		fs.SetDay(day)
+		return fs, nil
+	case BackendSQLite, "":
+		if keys != nil {
+			return nil, fmt.Errorf("encryption requires the file storage backend")
+		}
+		db, err := openSQLite(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateJSON(jsonPath, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.SetDay(day)
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// openSQLite opens the database at path. If it is damaged, the file is
+// moved aside and a new database is created from the sessions that can
+// still be read.
+func openSQLite(path string) (*SQLiteStorage, error) {
+	db, err := NewSQLiteStorage(path)
+	if err == nil {
+		if err = db.check(); err == nil {
+			return db, nil
+		}
+		db.Close()
+	}
+	if !isCorrupt(err) {
+		return nil, err
+	}
+
+	aside, moveErr := moveAside(path)
+	if moveErr != nil {
+		return nil, moveErr
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Rename(path+suffix, aside+suffix)
+	}
+	log.Printf("Storage file %s is damaged (%v); moved it to %s", path, err, aside)
+
+	db, err = NewSQLiteStorage(path)
+	if err != nil {
+		return nil, err
+	}
+	n, err := db.salvage(aside)
+	if err != nil {
+		log.Printf("No sessions could be recovered from %s: %v", aside, err)
+	} else {
+		log.Printf("Recovered %d sessions from %s", n, aside)
+	}
+	return db, nil
+}
+
+// moveLegacyJSON renames dbPath to jsonPath if it holds JSON rather than a
+// SQLite database.
+func moveLegacyJSON(dbPath, jsonPath string) error {
+	f, err := os.Open(dbPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open storage file: %v", err)
+	}
+	head := make([]byte, len(sqliteMagic))
+	n, _ := f.Read(head)
+	f.Close()
+	if n == 0 || bytes.Equal(head[:n], sqliteMagic) {
+		return nil
+	}
+
+	if _, err := os.Stat(jsonPath); err == nil {
+		return fmt.Errorf("both %s and %s hold JSON data; remove one", dbPath, jsonPath)
+	}
+	if err := os.Rename(dbPath, jsonPath); err != nil {
+		return fmt.Errorf("failed to move legacy storage file: %v", err)
+	}
+	return nil
+}
+
+// migrateJSON imports the JSON data file at path into db and renames it so
+// the import only happens once.
+func migrateJSON(path string, db *SQLiteStorage) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	src, err := NewFileStorage(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for migration: %v", path, err)
+	}
+	sessions, err := src.Sessions(time.Time{}, time.Unix(1<<62, 0))
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := db.importSessions(sessions); err != nil {
+		return fmt.Errorf("failed to migrate %s: %v", path, err)
+	}
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		return fmt.Errorf("failed to rename migrated file: %v", err)
+	}
+	log.Printf("Migrated %d sessions from %s to SQLite", len(sessions), path)
+	return nil
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// GroupBy selects how sessions are aggregated by Query.
+type GroupBy string
+
+const (
+	GroupByTitle    GroupBy = "title"
+	GroupByApp      GroupBy = "app"
+	GroupByCategory GroupBy = "category"
+	GroupByHour     GroupBy = "hour"
+	GroupByDay      GroupBy = "day"
+	GroupByWeek     GroupBy = "week"
+)
+
+// Query describes an aggregation over the active sessions that overlap
+// [From, To). A zero From has no lower bound and a zero To means now.
+//
+// Sessions are clipped to the range, so only their time inside it counts,
+// and split at bucket boundaries for time groups. Results hold one entry
+// per group, with the group label in Title and the summed Duration.
+// Title, app and category groups are ordered by duration, longest first,
+// and Start and Date span their sessions. Time groups are ordered
+// chronologically, and Start and Date span the bucket.
+type Query struct {
+	From    time.Time
+	To      time.Time
+	GroupBy GroupBy
+	// App and Title, when set, must match the application name and the
+	// window title.
+	App   *regexp.Regexp
+	Title *regexp.Regexp
+	// Tags lists tags that a session must all carry.
+	Tags    []string
+	Filters []StatsFilter
+	// Offset and Limit page through the ordered groups. A zero Limit
+	// returns every group.
+	Offset int
+	Limit  int
+}
+
+// ParseGroupBy checks a group-by name, defaulting to GroupByTitle.
+func ParseGroupBy(name string) (GroupBy, error) {
+	switch g := GroupBy(name); g {
+	case "":
+		return GroupByTitle, nil
+	case GroupByTitle, GroupByApp, GroupByCategory, GroupByHour, GroupByDay, GroupByWeek:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown group-by %q", name)
+}
+
+// runQuery answers a query from the raw sessions of a backend, with time
+// groups following day.
+func runQuery(s Storage, day Day, q Query) ([]WindowStats, error) {
+	to := q.To
+	if to.IsZero() {
+		to = time.Now().Add(time.Nanosecond)
+	}
+	sessions, err := s.Sessions(q.From, to)
+	if err != nil {
+		return nil, err
+	}
+
+	key, b := q.grouping(day)
+	statsMap := make(map[string]*WindowStats)
+	add := func(stat WindowStats) {
+		k := key(stat)
+		if existing, ok := statsMap[k]; ok {
+			existing.Duration += stat.Duration
+			if b == nil {
+				if stat.Start.Before(existing.Start) {
+					existing.Start = stat.Start
+				}
+				if stat.Date.After(existing.Date) {
+					existing.Date = stat.Date
+				}
+			}
+			return
+		}
+		group := &WindowStats{
+			Title:    k,
+			Duration: stat.Duration,
+			Start:    stat.Start,
+			Date:     stat.Date,
+		}
+		switch q.GroupBy {
+		case GroupByHour, GroupByDay, GroupByWeek:
+			group.Start = b.start(stat.Start)
+			group.Date = b.next(stat.Start)
+		case GroupByCategory:
+			group.Category = stat.Category
+		default:
+			group.Process = stat.Process
+			group.Class = stat.Class
+			group.Category = stat.Category
+		}
+		statsMap[k] = group
+	}
+
+	for _, stat := range sessions {
+		if stat.State != StateActive || !q.Matches(stat) {
+			continue
+		}
+		stat, ok := clip(stat, q.From, to)
+		if !ok {
+			continue
+		}
+		if b == nil {
+			add(stat)
+			continue
+		}
+		for _, piece := range splitAt(stat, b.next) {
+			add(piece)
+		}
+	}
+
+	stats := make([]WindowStats, 0, len(statsMap))
+	for _, stat := range statsMap {
+		stats = append(stats, *stat)
+	}
+	if b != nil {
+		sort.Slice(stats, func(i, j int) bool {
+			return stats[i].Start.Before(stats[j].Start)
+		})
+	} else {
+		sort.Slice(stats, func(i, j int) bool {
+			if stats[i].Duration != stats[j].Duration {
+				return stats[i].Duration > stats[j].Duration
+			}
+			return stats[i].Title < stats[j].Title
+		})
+	}
+
+	return Page(stats, q.Offset, q.Limit), nil
+}
+
+// bucket describes the time buckets of a time group: start maps a time to
+// the start of its bucket and next to the start of the following one.
+type bucket struct {
+	start, next func(time.Time) time.Time
+}
+
+// grouping returns the group key for a session and, for time groups, its
+// buckets. Sessions are split at bucket boundaries before they are keyed,
+// so only Start matters.
+func (q Query) grouping(day Day) (func(WindowStats) string, *bucket) {
+	switch q.GroupBy {
+	case GroupByApp:
+		return WindowStats.AppName, nil
+	case GroupByCategory:
+		return func(stat WindowStats) string {
+			if stat.Category == "" {
+				return "Uncategorized"
+			}
+			return stat.Category
+		}, nil
+	case GroupByHour:
+		// The offset tells apart the hour repeated when clocks go back
+		return func(stat WindowStats) string {
+			return day.HourStart(stat.Start).Format("2006-01-02 15:00 -07:00")
+		}, &bucket{day.HourStart, day.NextHour}
+	case GroupByDay:
+		return func(stat WindowStats) string {
+			return day.Start(stat.Start).Format("2006-01-02")
+		}, &bucket{day.Start, day.Next}
+	case GroupByWeek:
+		return func(stat WindowStats) string {
+			year, week := day.WeekStart(stat.Start).ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}, &bucket{day.WeekStart, day.NextWeek}
+	}
+	return byTitle, nil
+}
+
+// Matches reports whether a session passes the App, Title, Tags and
+// Filters criteria of q. The time range and state are not checked.
+func (q Query) Matches(stat WindowStats) bool {
+	if q.App != nil && !q.App.MatchString(stat.AppName()) {
+		return false
+	}
+	if q.Title != nil && !q.Title.MatchString(stat.Title) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !stat.HasTag(tag) {
+			return false
+		}
+	}
+	return included(stat, q.Filters)
+}
+
+// Page returns the limit entries of stats that follow the first offset.
+// A zero limit returns every entry after offset.
+func Page(stats []WindowStats, offset, limit int) []WindowStats {
+	if offset > len(stats) {
+		offset = len(stats)
+	}
+	if offset > 0 {
+		stats = stats[offset:]
+	}
+	if limit > 0 && limit < len(stats) {
+		stats = stats[:limit]
+	}
+	return stats
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestQueryClipsOverlappingSessions(t *testing.T) {
+	db := openFile(t, filepath.Join(t.TempDir(), "stats.json"))
+	defer db.Close()
+	db.SetDay(Day{Location: time.UTC})
+	saveAll(t, db, []WindowStats{
+		// Started before the range and ended inside it
+		session("doc", "a.exe", "", "", at(4, 9, 30), time.Hour),
+		// Started inside the range and ended after it
+		session("chat", "b.exe", "", "", at(4, 11, 45), 30*time.Minute),
+	})
+
+	got, err := db.Query(Query{From: at(4, 10, 0), To: at(4, 12, 0), GroupBy: GroupByApp})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	want := map[string]time.Duration{"a.exe": 30 * time.Minute, "b.exe": 15 * time.Minute}
+	if len(got) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(got), len(want))
+	}
+	for _, g := range got {
+		if g.Duration != want[g.Title] {
+			t.Errorf("%s = %v, want %v", g.Title, g.Duration, want[g.Title])
+		}
+	}
+}
+
+func TestQueryHoursWhenClocksGoBack(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := openFile(t, filepath.Join(t.TempDir(), "stats.json"))
+	defer db.Close()
+	db.SetDay(Day{Location: loc})
+
+	// 01:00 to 02:00 happens twice on 3 November 2024, first in EDT then
+	// in EST
+	first := time.Date(2024, 11, 3, 5, 10, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	saveAll(t, db, []WindowStats{
+		session("doc", "a.exe", "", "", first, 20*time.Minute),
+		session("doc", "a.exe", "", "", second, 30*time.Minute),
+	})
+
+	got, err := db.Query(Query{From: first.Add(-time.Hour), To: second.Add(time.Hour), GroupBy: GroupByHour})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	want := []struct {
+		title    string
+		start    time.Time
+		duration time.Duration
+	}{
+		{"2024-11-03 01:00 -04:00", first.Add(-10 * time.Minute), 20 * time.Minute},
+		{"2024-11-03 01:00 -05:00", second.Add(-10 * time.Minute), 30 * time.Minute},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d hours %+v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Title != w.title || !got[i].Start.Equal(w.start) || got[i].Duration != w.duration {
+			t.Errorf("hour %d = %s at %v for %v, want %s at %v for %v",
+				i, got[i].Title, got[i].Start, got[i].Duration, w.title, w.start, w.duration)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	stats := sessions(5)
+	for _, tt := range []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 0, []string{"Window 0", "Window 1", "Window 2", "Window 3", "Window 4"}},
+		{0, 2, []string{"Window 0", "Window 1"}},
+		{3, 0, []string{"Window 3", "Window 4"}},
+		{3, 5, []string{"Window 3", "Window 4"}},
+		{5, 2, nil},
+		{9, 2, nil},
+	} {
+		got := Page(stats, tt.offset, tt.limit)
+		var titles []string
+		for _, stat := range got {
+			titles = append(titles, stat.Title)
+		}
+		if fmt.Sprint(titles) != fmt.Sprint(tt.want) {
+			t.Errorf("Page(%d, %d) = %v, want %v", tt.offset, tt.limit, titles, tt.want)
+		}
+	}
+}
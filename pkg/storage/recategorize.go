@@ -0,0 +1,27 @@
+package storage
+
+import "slices"
+
+// Categorizer returns the category and tags for a session.
+type Categorizer func(stat WindowStats) (category string, tags []string)
+
+// recategorize updates the categories and tags of stats in place and
+// returns the indexes of the sessions that changed. Only window sessions
+// are categorized, and rollups keep the category of the sessions they
+// replaced since their title is no longer the window's.
+func recategorize(stats []WindowStats, categorize Categorizer) []int {
+	var changed []int
+	for i, stat := range stats {
+		if stat.State != StateActive || stat.Rollup {
+			continue
+		}
+		category, tags := categorize(stat)
+		if category == stat.Category && slices.Equal(tags, stat.Tags) {
+			continue
+		}
+		stats[i].Category = category
+		stats[i].Tags = tags
+		changed = append(changed, i)
+	}
+	return changed
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogDamageRecovery(t *testing.T) {
+	all := sessions(5)
+	good := []WindowStats{all[0], all[1], all[3], all[4]}
+
+	tests := []struct {
+		name string
+		// damage returns the damaged form of a log holding all
+		damage func(data []byte) []byte
+		want   []WindowStats
+	}{
+		{
+			name: "record in the middle",
+			damage: func(data []byte) []byte {
+				lines := bytes.Split(data, []byte("\n"))
+				lines[3] = bytes.Replace(lines[3], []byte("Window 2"), []byte("Window X"), 1)
+				return bytes.Join(lines, []byte("\n"))
+			},
+			want: good,
+		},
+		{
+			name: "garbage line",
+			damage: func(data []byte) []byte {
+				lines := bytes.Split(data, []byte("\n"))
+				lines[3] = []byte("\x00\x00\x00\x00")
+				return bytes.Join(lines, []byte("\n"))
+			},
+			want: good,
+		},
+		{
+			name: "header",
+			damage: func(data []byte) []byte {
+				return append([]byte(`{"format":"windowm`), data[len(logHeader)-1:]...)
+			},
+			want: all,
+		},
+		{
+			name: "truncated JSON document",
+			damage: func([]byte) []byte {
+				document, _ := json.Marshal(windowData{Stats: all})
+				return document[:len(document)-40]
+			},
+			want: all[:4],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stats.json")
+			db := openFile(t, path)
+			saveAll(t, db, all)
+			db.Close()
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			damaged := tt.damage(data)
+			if err := os.WriteFile(path, damaged, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			recovered := openFile(t, path)
+			defer recovered.Close()
+			checkSessions(t, stored(t, recovered), tt.want)
+
+			files := corruptFiles(t, path)
+			if len(files) != 1 {
+				t.Fatalf("damaged file moved aside to %v, want one file", files)
+			}
+			if aside, err := os.ReadFile(files[0]); err != nil || !bytes.Equal(aside, damaged) {
+				t.Errorf("file moved aside does not hold the damaged data: %v", err)
+			}
+			// The recovered data is a clean log again
+			if lines := logLines(t, path); lines[0]+"\n" != logHeader || len(lines) != 1+len(tt.want) {
+				t.Errorf("recovered log has %d lines starting %q", len(lines), lines[0])
+			}
+		})
+	}
+}
+
+func TestLogWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	db, err := NewEncryptedFileStorage(path, StaticKey(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStorage: %v", err)
+	}
+	saveAll(t, db, sessions(2))
+	db.Close()
+
+	if _, err := NewEncryptedFileStorage(path, StaticKey(bytes.Repeat([]byte{2}, 32))); err == nil {
+		t.Fatal("opened an encrypted file with the wrong key")
+	}
+	if _, err := NewFileStorage(path); err == nil {
+		t.Fatal("opened an encrypted file without a key")
+	}
+	// A wrong key is not damage; the file must be left alone
+	if files := corruptFiles(t, path); len(files) != 0 {
+		t.Errorf("encrypted file was moved aside to %v", files)
+	}
+}
+
+// damagePage overwrites the root page of the table or index name in the
+// SQLite database at path.
+func damagePage(t *testing.T, path, name string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page, pageSize int64
+	err = db.QueryRow("SELECT rootpage FROM sqlite_master WHERE name = ?", name).Scan(&page)
+	if err == nil {
+		err = db.QueryRow("PRAGMA page_size").Scan(&pageSize)
+	}
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(bytes.Repeat([]byte{0xff}, int(pageSize)), (page-1)*pageSize); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteDamageRecovery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, sqliteFile)
+	want := sessions(50)
+
+	db, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	saveAll(t, db, want)
+	db.Close()
+	// The table itself stays readable
+	damagePage(t, path, "sessions_date")
+
+	recovered, err := Open(dir, BackendSQLite, Day{Location: time.UTC}, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer recovered.Close()
+	got := stored(t, recovered)
+	for i := range got {
+		// SQLite keeps times in the local zone
+		got[i].Start = got[i].Start.UTC()
+		got[i].Date = got[i].Date.UTC()
+	}
+	checkSessions(t, got, want)
+
+	if err := recovered.(*SQLiteStorage).check(); err != nil {
+		t.Errorf("recovered database is still damaged: %v", err)
+	}
+	if files := corruptFiles(t, path); len(files) != 1 {
+		t.Errorf("damaged database moved aside to %v, want one file", files)
+	}
+}
+
+func TestSQLiteUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, sqliteFile)
+	db, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	saveAll(t, db, sessions(3))
+	db.Close()
+
+	damagePage(t, path, "sessions")
+
+	fresh, err := Open(dir, BackendSQLite, Day{}, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer fresh.Close()
+	if got := stored(t, fresh); len(got) != 0 {
+		t.Errorf("got %d sessions from an unreadable database", len(got))
+	}
+	saveAll(t, fresh, sessions(1))
+	if files := corruptFiles(t, path); len(files) != 1 {
+		t.Errorf("damaged database moved aside to %v, want one file", files)
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	backups := filepath.Join(dir, "backups")
+	db := openFile(t, filepath.Join(dir, "stats.json"))
+	defer db.Close()
+
+	if latest, err := LatestBackup(backups); err != nil || !latest.IsZero() {
+		t.Errorf("LatestBackup with no backups = %v, %v", latest, err)
+	}
+
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.Local)
+	var paths []string
+	for i := 0; i < 5; i++ {
+		saveAll(t, db, sessions(i + 1)[i:])
+		path, err := RotateBackups(db, backups, 3, now.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("RotateBackups: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	kept, err := listBackups(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 3 || kept[0] != paths[2] || kept[2] != paths[4] {
+		t.Errorf("kept backups %v, want the newest three of %v", kept, paths)
+	}
+	if latest, err := LatestBackup(backups); err != nil || !latest.Equal(now.Add(4*time.Hour)) {
+		t.Errorf("LatestBackup = %v, %v, want %v", latest, err, now.Add(4*time.Hour))
+	}
+	// Each backup is a complete log of the data at the time
+	checkSessions(t, reopen(t, kept[0]), sessions(3))
+	checkSessions(t, reopen(t, kept[2]), sessions(5))
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention limits how long data is kept. Raw sessions older than RawDays
+// are rolled up into one record per day, application, category and state,
+// and anything older than MaxDays is deleted. Zero disables either step.
+type Retention struct {
+	RawDays int
+	MaxDays int
+}
+
+// RetentionReport describes what a retention run changed.
+type RetentionReport struct {
+	// RolledUp sessions were replaced by Rollups daily records.
+	RolledUp int
+	Rollups  int
+	// Dropped records, raw or rolled up, were older than MaxDays.
+	Dropped int
+}
+
+// Changed reports whether the run changed anything.
+func (r RetentionReport) Changed() bool {
+	return r.RolledUp > 0 || r.Dropped > 0
+}
+
+func (r RetentionReport) String() string {
+	return fmt.Sprintf("rolled up %d sessions into %d daily records, dropped %d records",
+		r.RolledUp, r.Rollups, r.Dropped)
+}
+
+// cutoffs returns the start of the oldest day whose raw sessions are kept
+// and of the oldest day kept at all. A zero time means no limit.
+func (r Retention) cutoffs(day Day, now time.Time) (raw, max time.Time) {
+	today := day.Start(now)
+	if r.RawDays > 0 {
+		raw = day.at(today.Year(), today.Month(), today.Day()-r.RawDays)
+	}
+	if r.MaxDays > 0 {
+		max = day.at(today.Year(), today.Month(), today.Day()-r.MaxDays)
+	}
+	return raw, max
+}
+
+type rollupKey struct {
+	day             time.Time
+	process, class  string
+	category, state string
+	interrupted     bool
+}
+
+// rollup aggregates sessions into daily records. The records span their
+// whole day, keep the application, category and state, and take the
+// application name as their title. Tags are not kept.
+func rollup(sessions []WindowStats, day Day) []WindowStats {
+	groups := make(map[rollupKey]*WindowStats)
+	var order []rollupKey
+	for _, stat := range sessions {
+		start := day.Start(stat.Start)
+		key := rollupKey{
+			day:         start,
+			process:     stat.Process,
+			class:       stat.Class,
+			category:    stat.Category,
+			state:       stat.State,
+			interrupted: stat.Interrupted,
+		}
+		if group, ok := groups[key]; ok {
+			group.Duration += stat.Duration
+			continue
+		}
+		groups[key] = &WindowStats{
+			Title:       stat.AppName(),
+			Process:     stat.Process,
+			Class:       stat.Class,
+			Category:    stat.Category,
+			Duration:    stat.Duration,
+			Start:       start,
+			Date:        day.Next(stat.Start),
+			State:       stat.State,
+			Interrupted: stat.Interrupted,
+			Rollup:      true,
+		}
+		order = append(order, key)
+	}
+
+	rollups := make([]WindowStats, 0, len(order))
+	for _, key := range order {
+		rollups = append(rollups, *groups[key])
+	}
+	return rollups
+}
+
+// applyRetention splits stats into the records to keep, with old raw
+// sessions replaced by rollups, and reports what changed.
+func applyRetention(stats []WindowStats, r Retention, day Day, now time.Time) ([]WindowStats, RetentionReport) {
+	rawCutoff, maxCutoff := r.cutoffs(day, now)
+	var report RetentionReport
+	var kept, old []WindowStats
+	for _, stat := range stats {
+		switch {
+		case !maxCutoff.IsZero() && !stat.Date.After(maxCutoff):
+			report.Dropped++
+		case !stat.Rollup && !rawCutoff.IsZero() && !stat.Date.After(rawCutoff):
+			old = append(old, stat)
+		default:
+			kept = append(kept, stat)
+		}
+	}
+	rollups := rollup(old, day)
+	report.RolledUp = len(old)
+	report.Rollups = len(rollups)
+	return append(kept, rollups...), report
+}
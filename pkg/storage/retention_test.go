@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+var (
+	retentionDay = Day{StartHour: 4, Location: time.UTC}
+	retentionNow = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	retention    = Retention{RawDays: 2, MaxDays: 5}
+)
+
+func at(day, hour, min int) time.Time {
+	return time.Date(2024, 3, day, hour, min, 0, 0, time.UTC)
+}
+
+func session(title, process, category, state string, start time.Time, d time.Duration) WindowStats {
+	return WindowStats{
+		Title:    title,
+		Process:  process,
+		PID:      7,
+		Duration: d,
+		Start:    start,
+		Date:     start.Add(d),
+		State:    state,
+		Category: category,
+		Tags:     []string{"tag"},
+	}
+}
+
+func dailyRollup(title, process, category, state string, day int, d time.Duration) WindowStats {
+	return WindowStats{
+		Title:    title,
+		Process:  process,
+		Duration: d,
+		Start:    at(day, 4, 0),
+		Date:     at(day+1, 4, 0),
+		State:    state,
+		Category: category,
+		Rollup:   true,
+	}
+}
+
+// With days starting at 04:00, raw sessions are kept from 8 March and
+// anything at all from 5 March.
+var (
+	retentionInput = []WindowStats{
+		// Older than MaxDays
+		session("doc", "a.exe", "Work", "", at(4, 10, 0), 30*time.Minute),
+		session("late", "a.exe", "Work", "", at(5, 3, 0), 30*time.Minute),
+		dailyRollup("a.exe", "a.exe", "Work", "", 3, time.Hour),
+		// Rolled up by day, application, category and state
+		session("doc", "a.exe", "Work", "", at(6, 9, 0), 30*time.Minute),
+		session("other doc", "a.exe", "Work", "", at(6, 14, 0), 20*time.Minute),
+		session("chat", "b.exe", "Chat", "", at(6, 15, 0), 10*time.Minute),
+		session("Idle", "", "", StateIdle, at(6, 16, 0), 10*time.Minute),
+		session("night", "a.exe", "Work", "", at(7, 2, 0), 5*time.Minute),
+		session("early", "a.exe", "Work", "", at(8, 3, 30), 20*time.Minute),
+		// Existing rollups are kept as they are
+		dailyRollup("c.exe", "c.exe", "", "", 7, 2*time.Hour),
+		// Recent enough to stay raw
+		session("today", "a.exe", "Work", "", at(8, 5, 0), 15*time.Minute),
+	}
+	retentionWant = []WindowStats{
+		dailyRollup("Unknown", "", "", StateIdle, 6, 10*time.Minute),
+		dailyRollup("a.exe", "a.exe", "Work", "", 6, 55*time.Minute),
+		dailyRollup("b.exe", "b.exe", "Chat", "", 6, 10*time.Minute),
+		dailyRollup("a.exe", "a.exe", "Work", "", 7, 20*time.Minute),
+		dailyRollup("c.exe", "c.exe", "", "", 7, 2*time.Hour),
+		session("today", "a.exe", "Work", "", at(8, 5, 0), 15*time.Minute),
+	}
+	retentionReport = RetentionReport{RolledUp: 6, Rollups: 4, Dropped: 3}
+)
+
+// sortSessions orders stats by start and title, as backends keep records
+// in different orders.
+func sortSessions(stats []WindowStats) []WindowStats {
+	sort.SliceStable(stats, func(i, j int) bool {
+		if !stats[i].Start.Equal(stats[j].Start) {
+			return stats[i].Start.Before(stats[j].Start)
+		}
+		return stats[i].Title < stats[j].Title
+	})
+	return stats
+}
+
+func TestRetentionCutoffs(t *testing.T) {
+	for _, tt := range []struct {
+		r        Retention
+		now      time.Time
+		raw, max time.Time
+	}{
+		{retention, retentionNow, at(8, 4, 0), at(5, 4, 0)},
+		// Before 04:00 it is still the previous day
+		{retention, at(10, 3, 0), at(7, 4, 0), at(4, 4, 0)},
+		{Retention{RawDays: 10}, retentionNow, time.Date(2024, 2, 29, 4, 0, 0, 0, time.UTC), time.Time{}},
+		{Retention{MaxDays: 9}, retentionNow, time.Time{}, at(1, 4, 0)},
+		{Retention{}, retentionNow, time.Time{}, time.Time{}},
+	} {
+		raw, max := tt.r.cutoffs(retentionDay, tt.now)
+		if !raw.Equal(tt.raw) || !max.Equal(tt.max) {
+			t.Errorf("%+v at %v: cutoffs %v, %v, want %v, %v", tt.r, tt.now, raw, max, tt.raw, tt.max)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	input := append([]WindowStats(nil), retentionInput...)
+	got, report := applyRetention(input, retention, retentionDay, retentionNow)
+	if report != retentionReport {
+		t.Errorf("report = %+v, want %+v", report, retentionReport)
+	}
+	checkSessions(t, sortSessions(got), retentionWant)
+
+	// Running again changes nothing
+	again, report := applyRetention(got, retention, retentionDay, retentionNow)
+	if report.Changed() {
+		t.Errorf("second run reported %v", report)
+	}
+	checkSessions(t, sortSessions(again), retentionWant)
+
+	// A zero retention keeps everything
+	if kept, report := applyRetention(input, Retention{}, retentionDay, retentionNow); report.Changed() || len(kept) != len(input) {
+		t.Errorf("zero retention kept %d of %d sessions and reported %v", len(kept), len(input), report)
+	}
+}
+
+// dayStorage is a backend whose definition of a day can be set.
+type dayStorage interface {
+	Storage
+	SetDay(day Day)
+}
+
+func TestStorageRetention(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		open func(t *testing.T, dir string) dayStorage
+	}{
+		{"file", func(t *testing.T, dir string) dayStorage {
+			return openFile(t, filepath.Join(dir, "stats.json"))
+		}},
+		{"sqlite", func(t *testing.T, dir string) dayStorage {
+			db, err := NewSQLiteStorage(filepath.Join(dir, "stats.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStorage: %v", err)
+			}
+			return db
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.open(t, t.TempDir())
+			defer db.Close()
+			db.SetDay(retentionDay)
+			saveAll(t, db, retentionInput)
+
+			// Rollups keep the totals of the days they replace
+			q := Query{From: at(6, 4, 0), To: at(9, 4, 0), GroupBy: GroupByApp}
+			before, err := db.Query(q)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+
+			report, err := db.ApplyRetention(retention, retentionNow)
+			if err != nil {
+				t.Fatalf("ApplyRetention: %v", err)
+			}
+			if report != retentionReport {
+				t.Errorf("report = %+v, want %+v", report, retentionReport)
+			}
+			checkSessions(t, sortSessions(stored(t, db)), retentionWant)
+
+			after, err := db.Query(q)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if fmt.Sprint(totals(after)) != fmt.Sprint(totals(before)) {
+				t.Errorf("totals after retention %v, before %v", totals(after), totals(before))
+			}
+
+			if report, err := db.ApplyRetention(retention, retentionNow); err != nil || report.Changed() {
+				t.Errorf("second run reported %v, %v", report, err)
+			}
+		})
+	}
+}
+
+// totals maps group labels to their durations.
+func totals(groups []WindowStats) map[string]time.Duration {
+	m := make(map[string]time.Duration)
+	for _, g := range groups {
+		m[g.Title] = g.Duration
+	}
+	return m
+}
@@ -0,0 +1,505 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// schema holds the migrations for the SQLite database, applied in order
+// and tracked through PRAGMA user_version.
+var schema = []string{
+	`CREATE TABLE sessions (
+		id          INTEGER PRIMARY KEY,
+		title       TEXT    NOT NULL,
+		process     TEXT    NOT NULL DEFAULT '',
+		pid         INTEGER NOT NULL DEFAULT 0,
+		class       TEXT    NOT NULL DEFAULT '',
+		duration    INTEGER NOT NULL,
+		date        INTEGER NOT NULL,
+		state       TEXT    NOT NULL DEFAULT '',
+		interrupted INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX sessions_date ON sessions (date);
+	CREATE INDEX sessions_app ON sessions (process, class);`,
+	`ALTER TABLE sessions ADD COLUMN category TEXT NOT NULL DEFAULT '';
+	ALTER TABLE sessions ADD COLUMN tags TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE sessions ADD COLUMN start INTEGER NOT NULL DEFAULT 0;
+	UPDATE sessions SET start = date - duration;
+	CREATE INDEX sessions_start ON sessions (start);`,
+	`ALTER TABLE sessions ADD COLUMN rollup INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// SQLiteStorage keeps sessions in a SQLite database. Durations are stored
+// in nanoseconds, start and end dates as Unix nanoseconds and tags as a JSON array.
+type SQLiteStorage struct {
+	db  *sql.DB
+	day Day
+}
+
+func NewSQLiteStorage(filePath string) (*SQLiteStorage, error) {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", filePath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=secure_delete(ON)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	// A single connection serialises writers and keeps WAL readers simple
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStorage) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	for ; version < len(schema); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %v", err)
+		}
+		if _, err := tx.Exec(schema[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate database to version %d: %v", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate database: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate database: %v", err)
+		}
+	}
+	return nil
+}
+
+// errCorrupt is returned when the integrity check finds damage.
+var errCorrupt = errors.New("database is damaged")
+
+// check runs SQLite's quick integrity check.
+func (s *SQLiteStorage) check() error {
+	rows, err := s.db.Query("PRAGMA quick_check")
+	if err != nil {
+		return fmt.Errorf("failed to check database: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to check database: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check database: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", errCorrupt, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// isCorrupt reports whether err means the database file is damaged rather
+// than, say, unreadable.
+func isCorrupt(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_CORRUPT || code == sqlite3.SQLITE_NOTADB
+	}
+	return errors.Is(err, errCorrupt)
+}
+
+// salvage copies every session that can still be read from the damaged
+// database at path. Columns are matched by name, so databases of older
+// schema versions work too.
+func (s *SQLiteStorage) salvage(path string) (int, error) {
+	broken, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open damaged database: %v", err)
+	}
+	defer broken.Close()
+
+	rows, err := broken.Query("SELECT * FROM sessions")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read damaged database: %v", err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read damaged database: %v", err)
+	}
+
+	var sessions []WindowStats
+	for rows.Next() {
+		var stat WindowStats
+		var duration, start, date int64
+		var tags string
+		dest := make([]any, len(cols))
+		for i, col := range cols {
+			switch col {
+			case "title":
+				dest[i] = &stat.Title
+			case "process":
+				dest[i] = &stat.Process
+			case "pid":
+				dest[i] = &stat.PID
+			case "class":
+				dest[i] = &stat.Class
+			case "duration":
+				dest[i] = &duration
+			case "start":
+				dest[i] = &start
+			case "date":
+				dest[i] = &date
+			case "state":
+				dest[i] = &stat.State
+			case "interrupted":
+				dest[i] = &stat.Interrupted
+			case "category":
+				dest[i] = &stat.Category
+			case "tags":
+				dest[i] = &tags
+			case "rollup":
+				dest[i] = &stat.Rollup
+			default:
+				dest[i] = new(any)
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			continue
+		}
+		stat.Duration = time.Duration(duration)
+		stat.Date = time.Unix(0, date)
+		stat.Start = time.Unix(0, start)
+		if start == 0 {
+			stat.Start = stat.Date.Add(-stat.Duration)
+		}
+		if tags != "" {
+			json.Unmarshal([]byte(tags), &stat.Tags)
+		}
+		sessions = append(sessions, stat)
+	}
+	// Reading stops at the first damaged page; keep what came before it
+
+	if err := s.importSessions(sessions); err != nil {
+		return 0, err
+	}
+	return len(sessions), nil
+}
+
+// Backup writes a consistent copy of the database to path.
+func (s *SQLiteStorage) Backup(path string) error {
+	os.Remove(path)
+	if _, err := s.db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up database: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// SaveWindowStats records a finished session, split at day boundaries. A
+// zero Date is set to the current time and a zero Start to Date minus
+// Duration.
+func (s *SQLiteStorage) SaveWindowStats(stat WindowStats) error {
+	pieces := prepare(stat, s.day)
+	if len(pieces) == 1 {
+		return s.insert(s.db, pieces[0])
+	}
+	return s.importSessions(pieces)
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func (s *SQLiteStorage) insert(db execer, stat WindowStats) error {
+	tags, err := encodeTags(stat.Tags)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO sessions
+		(title, process, pid, class, duration, start, date, state, interrupted, category, tags, rollup)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		stat.Title, stat.Process, stat.PID, stat.Class, int64(stat.Duration),
+		stat.Start.UnixNano(), stat.Date.UnixNano(), stat.State, stat.Interrupted,
+		stat.Category, tags, stat.Rollup)
+	if err != nil {
+		return fmt.Errorf("failed to save session: %v", err)
+	}
+	return nil
+}
+
+// Sessions returns the sessions that overlap [from, to), unclipped.
+func (s *SQLiteStorage) Sessions(from, to time.Time) ([]WindowStats, error) {
+	return s.query(s.db, `WHERE start < ? AND date > ? ORDER BY start`, to.UnixNano(), unixNano(from))
+}
+
+// query reads the sessions selected by the SQL after the column list.
+func (s *SQLiteStorage) query(db queryer, where string, args ...any) ([]WindowStats, error) {
+	_, sessions, err := s.queryIDs(db, where, args...)
+	return sessions, err
+}
+
+// queryIDs is query that also returns the row ID of each session.
+func (s *SQLiteStorage) queryIDs(db queryer, where string, args ...any) ([]int64, []WindowStats, error) {
+	rows, err := db.Query(`SELECT id, title, process, pid, class, duration, start, date, state,
+		interrupted, category, tags, rollup FROM sessions `+where, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query sessions: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var sessions []WindowStats
+	for rows.Next() {
+		var stat WindowStats
+		var id, duration, start, date int64
+		var tags string
+		if err := rows.Scan(&id, &stat.Title, &stat.Process, &stat.PID, &stat.Class,
+			&duration, &start, &date, &stat.State, &stat.Interrupted,
+			&stat.Category, &tags, &stat.Rollup); err != nil {
+			return nil, nil, fmt.Errorf("failed to read session: %v", err)
+		}
+		if tags != "" {
+			if err := json.Unmarshal([]byte(tags), &stat.Tags); err != nil {
+				return nil, nil, fmt.Errorf("failed to read session tags: %v", err)
+			}
+		}
+		stat.Duration = time.Duration(duration)
+		stat.Start = time.Unix(0, start)
+		stat.Date = time.Unix(0, date)
+		ids = append(ids, id)
+		sessions = append(sessions, stat)
+	}
+	return ids, sessions, rows.Err()
+}
+
+// Forget deletes the sessions that sel matches, trimming those that only
+// partly fall into its time range. Deleted content is overwritten on disk
+// rather than left in free pages or the write-ahead log.
+func (s *SQLiteStorage) Forget(sel Selector) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to forget sessions: %v", err)
+	}
+	defer tx.Rollback()
+
+	to := sel.To
+	if to.IsZero() {
+		to = time.Unix(0, math.MaxInt64)
+	}
+	ids, sessions, err := s.queryIDs(tx, `WHERE start < ? AND date > ?`, to.UnixNano(), unixNano(sel.From))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i, stat := range sessions {
+		if !sel.matches(stat) {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, ids[i]); err != nil {
+			return 0, fmt.Errorf("failed to forget session: %v", err)
+		}
+		for _, piece := range sel.remainder(stat) {
+			if err := s.insert(tx, piece); err != nil {
+				return 0, err
+			}
+		}
+		n++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to forget sessions: %v", err)
+	}
+
+	if n > 0 {
+		if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return n, fmt.Errorf("failed to checkpoint database: %v", err)
+		}
+	}
+	return n, nil
+}
+
+// Recategorize updates the categories and tags of all sessions in one
+// transaction.
+func (s *SQLiteStorage) Recategorize(categorize Categorizer) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to recategorize sessions: %v", err)
+	}
+	defer tx.Rollback()
+
+	ids, sessions, err := s.queryIDs(tx, `WHERE state = ? AND rollup = 0`, StateActive)
+	if err != nil {
+		return 0, err
+	}
+	changed := recategorize(sessions, categorize)
+	for _, i := range changed {
+		tags, err := encodeTags(sessions[i].Tags)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`UPDATE sessions SET category = ?, tags = ? WHERE id = ?`,
+			sessions[i].Category, tags, ids[i]); err != nil {
+			return 0, fmt.Errorf("failed to recategorize session: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to recategorize sessions: %v", err)
+	}
+	return len(changed), nil
+}
+
+// vacuum rebuilds the database file without free pages.
+func (s *SQLiteStorage) vacuum() error {
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %v", err)
+	}
+	return nil
+}
+
+// SetDay changes the definition of a day. It must be called before the
+// storage is used.
+func (s *SQLiteStorage) SetDay(day Day) {
+	s.day = day
+}
+
+// Day returns the definition of a day.
+func (s *SQLiteStorage) Day() Day {
+	return s.day
+}
+
+// Query aggregates active sessions as described by q.
+func (s *SQLiteStorage) Query(q Query) ([]WindowStats, error) {
+	return runQuery(s, s.day, q)
+}
+
+// ApplyRetention rolls up and deletes old data according to r in a single
+// transaction.
+func (s *SQLiteStorage) ApplyRetention(r Retention, now time.Time) (RetentionReport, error) {
+	var report RetentionReport
+	rawCutoff, maxCutoff := r.cutoffs(s.day, now)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, fmt.Errorf("failed to apply retention: %v", err)
+	}
+	defer tx.Rollback()
+
+	if !maxCutoff.IsZero() {
+		res, err := tx.Exec(`DELETE FROM sessions WHERE date <= ?`, maxCutoff.UnixNano())
+		if err != nil {
+			return report, fmt.Errorf("failed to drop old sessions: %v", err)
+		}
+		dropped, _ := res.RowsAffected()
+		report.Dropped = int(dropped)
+	}
+
+	if !rawCutoff.IsZero() {
+		old, err := s.query(tx, `WHERE rollup = 0 AND date <= ?`, rawCutoff.UnixNano())
+		if err != nil {
+			return report, err
+		}
+		if len(old) > 0 {
+			if _, err := tx.Exec(`DELETE FROM sessions WHERE rollup = 0 AND date <= ?`, rawCutoff.UnixNano()); err != nil {
+				return report, fmt.Errorf("failed to roll up sessions: %v", err)
+			}
+			rollups := rollup(old, s.day)
+			for _, stat := range rollups {
+				if err := s.insert(tx, stat); err != nil {
+					return report, err
+				}
+			}
+			report.RolledUp = len(old)
+			report.Rollups = len(rollups)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return RetentionReport{}, fmt.Errorf("failed to apply retention: %v", err)
+	}
+	return report, nil
+}
+
+// GetDailyStats returns today's usage grouped by window title.
+func (s *SQLiteStorage) GetDailyStats(filters ...StatsFilter) ([]WindowStats, error) {
+	return s.Query(dailyQuery(s.day, GroupByTitle, filters))
+}
+
+// GetDailyAppStats returns today's usage grouped by application. Title
+// holds the application name in the results.
+func (s *SQLiteStorage) GetDailyAppStats(filters ...StatsFilter) ([]WindowStats, error) {
+	return s.Query(dailyQuery(s.day, GroupByApp, filters))
+}
+
+// GetDailyCategoryStats returns today's usage grouped by category. Title
+// holds the category name in the results.
+func (s *SQLiteStorage) GetDailyCategoryStats(filters ...StatsFilter) ([]WindowStats, error) {
+	return s.Query(dailyQuery(s.day, GroupByCategory, filters))
+}
+
+// unixNano is t.UnixNano, with the zero time mapped below every stored
+// date rather than to an undefined value.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return math.MinInt64
+	}
+	return t.UnixNano()
+}
+
+func encodeTags(tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal tags: %v", err)
+	}
+	return string(data), nil
+}
+
+// importSessions copies sessions into the database in one transaction,
+// keeping their original dates.
+func (s *SQLiteStorage) importSessions(sessions []WindowStats) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to import sessions: %v", err)
+	}
+	for _, stat := range sessions {
+		if err := s.insert(tx, stat); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -1,107 +1,192 @@
 package storage
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
-	"sync"
 	"time"
 )
 
-type Storage struct {
-	filePath string
-	mutex    sync.RWMutex
-	data     *windowData
+// Storage persists window sessions and answers queries over them.
+type Storage interface {
+	// SaveWindowStats records a finished session, split at day
+	// boundaries. A zero Date is set to the current time and a zero Start
+	// to Date minus Duration.
+	SaveWindowStats(stat WindowStats) error
+	// Sessions returns the raw sessions that overlap [from, to), unclipped.
+	Sessions(from, to time.Time) ([]WindowStats, error)
+	// Query aggregates active sessions as described by q.
+	Query(q Query) ([]WindowStats, error)
+	// GetDailyStats returns today's usage grouped by window title.
+	GetDailyStats(filters ...StatsFilter) ([]WindowStats, error)
+	// GetDailyAppStats returns today's usage grouped by application.
+	// Title holds the application name in the results.
+	GetDailyAppStats(filters ...StatsFilter) ([]WindowStats, error)
+	// GetDailyCategoryStats returns today's usage grouped by category.
+	// Title holds the category name in the results.
+	GetDailyCategoryStats(filters ...StatsFilter) ([]WindowStats, error)
+	// ApplyRetention rolls up and deletes old data according to r, with
+	// days counted back from now.
+	ApplyRetention(r Retention, now time.Time) (RetentionReport, error)
+	// Forget deletes the sessions that sel matches, including rollups,
+	// and returns how many were affected.
+	Forget(sel Selector) (int, error)
+	// Recategorize sets the category and tags of every stored window
+	// session to those returned by categorize, and returns how many
+	// sessions changed.
+	Recategorize(categorize Categorizer) (int, error)
+	// Backup writes a consistent copy of all data to path.
+	Backup(path string) error
+	// Day returns the definition of a day used to split sessions and
+	// group them by day.
+	Day() Day
+	Close() error
 }
 
+// Session states. Only active sessions count towards window usage.
+const (
+	StateActive = ""
+	StateIdle   = "idle"
+	StateLocked = "locked"
+	StateAsleep = "asleep"
+	StateGap    = "gap"
+)
+
 type WindowStats struct {
 	Title    string
+	Process  string
+	PID      uint32
+	Class    string
 	Duration time.Duration
+	// Start and Date are when the session began and ended.
+	Start    time.Time
 	Date     time.Time
+	State    string   `json:",omitempty"`
+	Category string   `json:",omitempty"`
+	Tags     []string `json:",omitempty"`
+	// Interrupted marks sessions that were credited across a gap in
+	// sampling, such as a suspend that was not announced.
+	Interrupted bool `json:",omitempty"`
+	// Rollup marks a daily total that replaced older raw sessions. It
+	// spans its whole day and its title is the application name.
+	Rollup bool `json:",omitempty"`
 }
 
-type windowData struct {
-	Stats []WindowStats `json:"stats"`
-}
-
-func NewStorage(filePath string) (*Storage, error) {
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %v", err)
+// AppName identifies the application that owned the window: the process
+// executable if known, otherwise the window class.
+func (ws WindowStats) AppName() string {
+	if ws.Process != "" {
+		return ws.Process
 	}
-
-	s := &Storage{
-		filePath: filePath,
-		data:     &windowData{Stats: []WindowStats{}},
+	if ws.Class != "" {
+		return ws.Class
 	}
+	return "Unknown"
+}
 
-	if _, err := os.Stat(filePath); err == nil {
-		file, err := os.ReadFile(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read storage file: %v", err)
-		}
-		if err := json.Unmarshal(file, s.data); err != nil {
-			return nil, fmt.Errorf("failed to parse storage file: %v", err)
+// HasTag reports whether the session carries tag.
+func (ws WindowStats) HasTag(tag string) bool {
+	for _, t := range ws.Tags {
+		if t == tag {
+			return true
 		}
 	}
+	return false
+}
+
+// StatsFilter decides whether a session is included in aggregated stats.
+type StatsFilter func(WindowStats) bool
 
-	return s, nil
+// SkipInterrupted leaves out sessions that were credited across a gap.
+func SkipInterrupted(stat WindowStats) bool {
+	return !stat.Interrupted
 }
 
-func (s *Storage) Close() error {
-	return s.save()
+func byTitle(stat WindowStats) string {
+	return stat.Title
 }
 
-func (s *Storage) save() error {
-	data, err := json.MarshalIndent(s.data, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal data: %v", err)
+// prepare fills in the times of a session being saved and splits it at
+// day boundaries.
+func prepare(stat WindowStats, day Day) []WindowStats {
+	if stat.Date.IsZero() {
+		stat.Date = time.Now().Round(0)
+	}
+	if stat.Start.IsZero() {
+		stat.Start = stat.Date.Add(-stat.Duration)
 	}
-	return os.WriteFile(s.filePath, data, 0644)
+	return splitAt(stat, day.Next)
 }
 
-func (s *Storage) SaveWindowStats(title string, duration time.Duration) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	s.data.Stats = append(s.data.Stats, WindowStats{
-		Title:    title,
-		Duration: duration,
-		Date:     time.Now(),
-	})
-
-	return s.save()
+// splitAt cuts a session at every boundary returned by next, which maps a
+// time to the first boundary after it. The duration is shared out in
+// proportion to wall time, with the last piece taking the remainder so the
+// total is preserved.
+func splitAt(stat WindowStats, next func(time.Time) time.Time) []WindowStats {
+	var pieces []WindowStats
+	span := stat.Date.Sub(stat.Start)
+	remaining := stat.Duration
+	for start := stat.Start; ; {
+		boundary := next(start)
+		if !boundary.Before(stat.Date) {
+			piece := stat
+			piece.Start = start
+			piece.Duration = remaining
+			return append(pieces, piece)
+		}
+		piece := stat
+		piece.Start = start
+		piece.Date = boundary
+		piece.Duration = share(stat.Duration, boundary.Sub(start), span)
+		if piece.Duration > remaining {
+			piece.Duration = remaining
+		}
+		remaining -= piece.Duration
+		pieces = append(pieces, piece)
+		start = boundary
+	}
 }
 
-func (s *Storage) GetDailyStats() ([]WindowStats, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	oneDayAgo := time.Now().Add(-24 * time.Hour)
-	statsMap := make(map[string]*WindowStats)
+// clip trims a session to [from, to), keeping the share of its duration
+// that falls inside. It reports false if nothing is left.
+func clip(stat WindowStats, from, to time.Time) (WindowStats, bool) {
+	span := stat.Date.Sub(stat.Start)
+	if !from.IsZero() && stat.Start.Before(from) {
+		stat.Start = from
+	}
+	if stat.Date.After(to) {
+		stat.Date = to
+	}
+	if !stat.Date.After(stat.Start) {
+		return stat, false
+	}
+	stat.Duration = share(stat.Duration, stat.Date.Sub(stat.Start), span)
+	return stat, true
+}
 
-	for _, stat := range s.data.Stats {
-		if stat.Date.After(oneDayAgo) {
-			if existing, ok := statsMap[stat.Title]; ok {
-				existing.Duration += stat.Duration
-				if stat.Date.After(existing.Date) {
-					existing.Date = stat.Date
-				}
-			} else {
-				statsMap[stat.Title] = &WindowStats{
-					Title:    stat.Title,
-					Duration: stat.Duration,
-					Date:     stat.Date,
-				}
-			}
-		}
+// share returns the part of d that corresponds to part of whole. Sessions
+// are usually as long as their span, but rollups are not.
+func share(d, part, whole time.Duration) time.Duration {
+	if whole <= 0 || part >= whole {
+		return d
 	}
+	return time.Duration(float64(d) * float64(part) / float64(whole))
+}
 
-	var stats []WindowStats
-	for _, stat := range statsMap {
-		stats = append(stats, *stat)
+// dailyQuery is the query behind GetDailyStats and GetDailyAppStats:
+// today's usage grouped as requested.
+func dailyQuery(day Day, groupBy GroupBy, filters []StatsFilter) Query {
+	now := time.Now()
+	return Query{
+		From:    day.Start(now),
+		To:      now.Add(time.Nanosecond),
+		GroupBy: groupBy,
+		Filters: filters,
 	}
+}
 
-	return stats, nil
-}
\ No newline at end of file
+func included(stat WindowStats, filters []StatsFilter) bool {
+	for _, filter := range filters {
+		if !filter(stat) {
+			return false
+		}
+	}
+	return true
+}
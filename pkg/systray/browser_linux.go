@@ -0,0 +1,8 @@
+package systray
+
+import "os/exec"
+
+// openBrowser opens url in the user's default browser
+func openBrowser(url string) error {
+	return exec.Command("xdg-open", url).Start()
+}
@@ -1,41 +1,61 @@
 package systray
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"time"
 
 	"github.com/getlantern/systray"
 	"github.com/windowmonitor/pkg/analytics"
+	"github.com/windowmonitor/pkg/monitor"
 	"github.com/windowmonitor/pkg/notification"
 	"github.com/windowmonitor/pkg/storage"
 )
 
 type TrayManager struct {
-	storage    *storage.Storage
-	visualizer *analytics.Visualizer
-	notifier   *notification.WindowsNotifier
+	storage      storage.Storage
+	visualizer   *analytics.Visualizer
+	monitor      *monitor.WindowMonitor
+	notifier     *notification.DesktopNotifier
+	productivity *analytics.Productivity
 }
 
-func NewTrayManager(storage *storage.Storage, visualizer *analytics.Visualizer) *TrayManager {
-	// Create a Windows notifier
-	winNotifier := notification.NewWindowsNotifier(storage)
+func NewTrayManager(storage storage.Storage, visualizer *analytics.Visualizer, monitor *monitor.WindowMonitor) *TrayManager {
+	// Create a desktop notifier
+	notifier := notification.NewDesktopNotifier(storage)
 
 	return &TrayManager{
 		storage:    storage,
 		visualizer: visualizer,
-		notifier:   winNotifier,
+		monitor:    monitor,
+		notifier:   notifier,
 	}
 }
 
+// SetProductivity shows the day's productivity score in the tooltip and the
+// summary shown on exit.
+func (tm *TrayManager) SetProductivity(productivity *analytics.Productivity) {
+	tm.productivity = productivity
+	tm.notifier.SetProductivity(productivity)
+}
+
 func (tm *TrayManager) Start() {
 	systray.Run(tm.onReady, tm.onExit)
 }
 
+// Quit exits the tray loop as if the user had picked Quit from the menu
+func (tm *TrayManager) Quit() {
+	systray.Quit()
+}
+
 func (tm *TrayManager) onReady() {
 	systray.SetIcon(getIcon())
 	systray.SetTitle("Window Monitor")
 	systray.SetTooltip("Window Monitor - Track your window usage")
+	if tm.productivity != nil {
+		go tm.updateTooltip()
+	}
 
 	mOpenStats := systray.AddMenuItem("Open Statistics", "View your window usage statistics")
 	systray.AddSeparator()
@@ -47,8 +67,7 @@ func (tm *TrayManager) onReady() {
 			case <-mOpenStats.ClickedCh:
 				fmt.Println("Opening statistics dashboard...")
 				url := "http://localhost:8080"
-				err := exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
-				if err != nil {
+				if err := openBrowser(url); err != nil {
 					fmt.Printf("Failed to open browser: %v\n", err)
 				}
 
@@ -61,7 +80,28 @@ func (tm *TrayManager) onReady() {
 	}()
 }
 
+// updateTooltip keeps the day's productivity score in the tooltip. It does
+// not return.
+func (tm *TrayManager) updateTooltip() {
+	for {
+		trend, err := tm.productivity.Trend(time.Now(), 7)
+		if err != nil {
+			fmt.Printf("Failed to get productivity score: %v\n", err)
+		} else {
+			systray.SetTooltip("Window Monitor - Productivity " + trend.Describe())
+		}
+		time.Sleep(5 * time.Minute)
+	}
+}
+
 func (tm *TrayManager) onExit() {
+	// Record the window that is still open before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tm.monitor.Stop(ctx); err != nil {
+		fmt.Printf("Failed to stop monitor: %v\n", err)
+	}
+
 	if err := tm.notifier.ShowSummaryNotification(); err != nil {
 		fmt.Printf("Failed to show summary notification: %v\n", err)
 	}
@@ -74,18 +114,18 @@ func (tm *TrayManager) onExit() {
 func getIcon() []byte {
 	// This is a properly formatted 16x16 icon in RGBA format
 	icon := make([]byte, 16*16*4)
-	
+
 	// Fill with a simple blue square pattern
 	for i := 0; i < 16; i++ {
 		for j := 0; j < 16; j++ {
 			pos := (i*16 + j) * 4
 			// Create a blue color with full opacity
-			icon[pos] = 0      // R
-			icon[pos+1] = 0    // G
-			icon[pos+2] = 255  // B
-			icon[pos+3] = 255  // A (opacity)
+			icon[pos] = 0     // R
+			icon[pos+1] = 0   // G
+			icon[pos+2] = 255 // B
+			icon[pos+3] = 255 // A (opacity)
 		}
 	}
-	
+
 	return icon
 }
@@ -0,0 +1,473 @@
+// Package x11 is a minimal X11 protocol client. It implements just enough of
+// the core protocol to read window properties and receive PropertyNotify
+// events, plus the MIT-SCREEN-SAVER idle query, which is all the window
+// monitor needs, without linking Xlib.
+package x11
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Predefined atoms from the core protocol.
+const (
+	AtomNone     Atom = 0
+	AtomCardinal Atom = 6
+	AtomString   Atom = 31
+	AtomWindow   Atom = 33
+	AtomWMName   Atom = 39
+	AtomWMClass  Atom = 67
+)
+
+const (
+	opChangeWindowAttributes = 2
+	opInternAtom             = 16
+	opGetProperty            = 20
+	opQueryExtension         = 98
+
+	screenSaverQueryInfo = 1
+
+	cwEventMask = 1 << 11
+
+	// PropertyChangeMask selects PropertyNotify events.
+	PropertyChangeMask = 1 << 22
+	// PropertyNotify is the event code for a changed window property.
+	PropertyNotify = 28
+)
+
+var byteOrder = binary.LittleEndian
+
+type (
+	Atom   uint32
+	Window uint32
+)
+
+// Event is an event sent by the server. Only the fields shared by
+// PropertyNotify are decoded.
+type Event struct {
+	Code   byte
+	Window Window
+	Atom   Atom
+}
+
+// Error is an X protocol error returned in place of a reply.
+type Error struct {
+	Code     byte
+	Sequence uint16
+	Opcode   byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("x11: error %d on request %d (opcode %d)", e.Code, e.Sequence, e.Opcode)
+}
+
+// Conn is a connection to an X server. It is not safe for concurrent use.
+type Conn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	seq   uint16
+	root  Window
+	atoms map[string]Atom
+	exts  map[string]byte
+
+	events []Event
+}
+
+// Dial connects to the X server named by display, or $DISPLAY if empty.
+func Dial(display string) (*Conn, error) {
+	if display == "" {
+		display = os.Getenv("DISPLAY")
+	}
+	if display == "" {
+		return nil, errors.New("x11: DISPLAY not set")
+	}
+
+	host, number, err := parseDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+
+	var nc net.Conn
+	if host == "" || host == "unix" {
+		nc, err = net.Dial("unix", "/tmp/.X11-unix/X"+number)
+	} else {
+		n, _ := strconv.Atoi(number)
+		nc, err = net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("x11: failed to connect to %s: %v", display, err)
+	}
+
+	c := &Conn{
+		conn:  nc,
+		r:     bufio.NewReader(nc),
+		atoms: make(map[string]Atom),
+		exts:  make(map[string]byte),
+	}
+	authName, authData := readAuthority(number)
+	if err := c.setup(authName, authData); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseDisplay splits "host:display.screen" into host and display number.
+func parseDisplay(display string) (host, number string, err error) {
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("x11: invalid display %q", display)
+	}
+	host, number = display[:i], display[i+1:]
+	if j := strings.Index(number, "."); j >= 0 {
+		number = number[:j]
+	}
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", "", fmt.Errorf("x11: invalid display %q", display)
+	}
+	return host, number, nil
+}
+
+// readAuthority looks up an MIT-MAGIC-COOKIE-1 for the display in
+// $XAUTHORITY or ~/.Xauthority. Servers started without -auth (such as a
+// bare Xvfb) accept connections without one.
+func readAuthority(number string) (name string, data []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".Xauthority")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	readField := func() ([]byte, error) {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			return "", nil
+		}
+		fields := make([][]byte, 4) // address, number, name, data
+		for i := range fields {
+			if fields[i], err = readField(); err != nil {
+				return "", nil
+			}
+		}
+		if string(fields[1]) == number && string(fields[2]) == "MIT-MAGIC-COOKIE-1" {
+			return string(fields[2]), fields[3]
+		}
+	}
+}
+
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+func (c *Conn) setup(authName string, authData []byte) error {
+	buf := make([]byte, 12, 12+len(authName)+pad(len(authName))+len(authData)+pad(len(authData)))
+	buf[0] = 'l'
+	byteOrder.PutUint16(buf[2:], 11)
+	byteOrder.PutUint16(buf[4:], 0)
+	byteOrder.PutUint16(buf[6:], uint16(len(authName)))
+	byteOrder.PutUint16(buf[8:], uint16(len(authData)))
+	buf = append(buf, authName...)
+	buf = append(buf, make([]byte, pad(len(authName)))...)
+	buf = append(buf, authData...)
+	buf = append(buf, make([]byte, pad(len(authData)))...)
+	if _, err := c.conn.Write(buf); err != nil {
+		return fmt.Errorf("x11: setup failed: %v", err)
+	}
+
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return fmt.Errorf("x11: setup failed: %v", err)
+	}
+	body := make([]byte, int(byteOrder.Uint16(head[6:]))*4)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return fmt.Errorf("x11: setup failed: %v", err)
+	}
+
+	switch head[0] {
+	case 1:
+	case 0:
+		reason := body[:min(int(head[1]), len(body))]
+		return fmt.Errorf("x11: connection refused: %s", reason)
+	default:
+		return errors.New("x11: server requires unsupported authentication")
+	}
+
+	if len(body) < 32 {
+		return errors.New("x11: short setup reply")
+	}
+	vendorLen := int(byteOrder.Uint16(body[16:]))
+	numFormats := int(body[21])
+	off := 32 + vendorLen + pad(vendorLen) + 8*numFormats
+	if len(body) < off+4 {
+		return errors.New("x11: setup reply has no screens")
+	}
+	c.root = Window(byteOrder.Uint32(body[off:]))
+	return nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Root returns the root window of the default screen.
+func (c *Conn) Root() Window {
+	return c.root
+}
+
+// send writes a request and returns its sequence number.
+func (c *Conn) send(req []byte) (uint16, error) {
+	c.seq++
+	if _, err := c.conn.Write(req); err != nil {
+		return 0, fmt.Errorf("x11: write failed: %v", err)
+	}
+	return c.seq, nil
+}
+
+// readPacket reads the next reply, error or event from the server.
+func (c *Conn) readPacket() ([]byte, error) {
+	head := make([]byte, 32)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return nil, err
+	}
+	if head[0] != 1 {
+		return head, nil
+	}
+	extra := int(byteOrder.Uint32(head[4:])) * 4
+	if extra == 0 {
+		return head, nil
+	}
+	body := make([]byte, 32+extra)
+	copy(body, head)
+	if _, err := io.ReadFull(c.r, body[32:]); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// reply waits for the reply to request seq, queueing any events that
+// arrive first.
+func (c *Conn) reply(seq uint16) ([]byte, error) {
+	for {
+		p, err := c.readPacket()
+		if err != nil {
+			return nil, fmt.Errorf("x11: read failed: %v", err)
+		}
+		switch p[0] {
+		case 0:
+			xerr := &Error{Code: p[1], Sequence: byteOrder.Uint16(p[2:]), Opcode: p[10]}
+			if xerr.Sequence == seq {
+				return nil, xerr
+			}
+		case 1:
+			if byteOrder.Uint16(p[2:]) == seq {
+				return p, nil
+			}
+		default:
+			c.events = append(c.events, parseEvent(p))
+		}
+	}
+}
+
+func parseEvent(p []byte) Event {
+	return Event{
+		Code:   p[0] & 0x7f,
+		Window: Window(byteOrder.Uint32(p[4:])),
+		Atom:   Atom(byteOrder.Uint32(p[8:])),
+	}
+}
+
+// InternAtom returns the atom for name, caching the result.
+func (c *Conn) InternAtom(name string) (Atom, error) {
+	if a, ok := c.atoms[name]; ok {
+		return a, nil
+	}
+
+	req := make([]byte, 8, 8+len(name)+pad(len(name)))
+	req[0] = opInternAtom
+	byteOrder.PutUint16(req[2:], uint16((8+len(name)+pad(len(name)))/4))
+	byteOrder.PutUint16(req[4:], uint16(len(name)))
+	req = append(req, name...)
+	req = append(req, make([]byte, pad(len(name)))...)
+
+	seq, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	p, err := c.reply(seq)
+	if err != nil {
+		return 0, err
+	}
+	a := Atom(byteOrder.Uint32(p[8:]))
+	c.atoms[name] = a
+	return a, nil
+}
+
+// Property is the value of a window property.
+type Property struct {
+	Type   Atom
+	Format byte
+	Value  []byte
+}
+
+// GetProperty reads up to 64 KiB of property prop on window w. A missing
+// property is returned with Type AtomNone and no error.
+func (c *Conn) GetProperty(w Window, prop Atom) (Property, error) {
+	req := make([]byte, 24)
+	req[0] = opGetProperty
+	byteOrder.PutUint16(req[2:], 6)
+	byteOrder.PutUint32(req[4:], uint32(w))
+	byteOrder.PutUint32(req[8:], uint32(prop))
+	byteOrder.PutUint32(req[12:], uint32(AtomNone))
+	byteOrder.PutUint32(req[16:], 0)
+	byteOrder.PutUint32(req[20:], 1<<14)
+
+	seq, err := c.send(req)
+	if err != nil {
+		return Property{}, err
+	}
+	p, err := c.reply(seq)
+	if err != nil {
+		return Property{}, err
+	}
+
+	format := p[1]
+	n := int(byteOrder.Uint32(p[16:]))
+	size := n * int(format) / 8
+	if 32+size > len(p) {
+		return Property{}, errors.New("x11: malformed GetProperty reply")
+	}
+	return Property{
+		Type:   Atom(byteOrder.Uint32(p[8:])),
+		Format: format,
+		Value:  p[32 : 32+size],
+	}, nil
+}
+
+// Uint32 returns the first 32-bit item of the property, or 0.
+func (p Property) Uint32() uint32 {
+	if p.Format != 32 || len(p.Value) < 4 {
+		return 0
+	}
+	return byteOrder.Uint32(p.Value)
+}
+
+// QueryExtension returns the major opcode of the named extension, or 0 if
+// the server does not support it.
+func (c *Conn) QueryExtension(name string) (byte, error) {
+	if op, ok := c.exts[name]; ok {
+		return op, nil
+	}
+
+	req := make([]byte, 8, 8+len(name)+pad(len(name)))
+	req[0] = opQueryExtension
+	byteOrder.PutUint16(req[2:], uint16((8+len(name)+pad(len(name)))/4))
+	byteOrder.PutUint16(req[4:], uint16(len(name)))
+	req = append(req, name...)
+	req = append(req, make([]byte, pad(len(name)))...)
+
+	seq, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	p, err := c.reply(seq)
+	if err != nil {
+		return 0, err
+	}
+	var op byte
+	if p[8] != 0 {
+		op = p[9]
+	}
+	c.exts[name] = op
+	return op, nil
+}
+
+// ScreenSaverIdle returns the time since the last user input, as reported
+// by the MIT-SCREEN-SAVER extension.
+func (c *Conn) ScreenSaverIdle() (time.Duration, error) {
+	op, err := c.QueryExtension("MIT-SCREEN-SAVER")
+	if err != nil {
+		return 0, err
+	}
+	if op == 0 {
+		return 0, errors.New("x11: MIT-SCREEN-SAVER extension not available")
+	}
+
+	req := make([]byte, 8)
+	req[0] = op
+	req[1] = screenSaverQueryInfo
+	byteOrder.PutUint16(req[2:], 2)
+	byteOrder.PutUint32(req[4:], uint32(c.root))
+
+	seq, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	p, err := c.reply(seq)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(byteOrder.Uint32(p[16:])) * time.Millisecond, nil
+}
+
+// SelectEvents sets the event mask this connection holds on window w,
+// replacing any previous mask. A mask of 0 stops events for w.
+func (c *Conn) SelectEvents(w Window, mask uint32) error {
+	req := make([]byte, 16)
+	req[0] = opChangeWindowAttributes
+	byteOrder.PutUint16(req[2:], 4)
+	byteOrder.PutUint32(req[4:], uint32(w))
+	byteOrder.PutUint32(req[8:], cwEventMask)
+	byteOrder.PutUint32(req[12:], mask)
+	_, err := c.send(req)
+	return err
+}
+
+// NextEvent blocks until the server sends an event. Errors for requests
+// without a reply, such as SelectEvents on a destroyed window, are returned
+// here as *Error.
+func (c *Conn) NextEvent() (Event, error) {
+	if len(c.events) > 0 {
+		ev := c.events[0]
+		c.events = c.events[1:]
+		return ev, nil
+	}
+	p, err := c.readPacket()
+	if err != nil {
+		return Event{}, fmt.Errorf("x11: read failed: %v", err)
+	}
+	switch p[0] {
+	case 0:
+		return Event{}, &Error{Code: p[1], Sequence: byteOrder.Uint16(p[2:]), Opcode: p[10]}
+	case 1:
+		return Event{}, errors.New("x11: unexpected reply")
+	}
+	return parseEvent(p), nil
+}